@@ -0,0 +1,107 @@
+// Package bookmark implements the bookmark addon, which lists named directories
+// and changes to the one selected.
+package bookmark
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/elves/elvish/pkg/cli"
+	"github.com/elves/elvish/pkg/fsutil"
+	"github.com/elves/elvish/pkg/ui"
+	"github.com/elves/elvish/pkg/wcwidth"
+)
+
+// Config is the configuration to start the bookmark addon.
+type Config struct {
+	// Binding is the key binding.
+	Binding cli.Handler
+	// Bookmarks is called to get the bookmarks to show.
+	Bookmarks func() []Bookmark
+	// Chdir is called to change to the path of the accepted bookmark.
+	Chdir func(path string) error
+}
+
+// Bookmark is a named directory.
+type Bookmark struct {
+	Name string
+	Path string
+}
+
+// Start starts the bookmark addon.
+func Start(app cli.App, cfg Config) {
+	if cfg.Bookmarks == nil {
+		app.Notify("no bookmarks")
+		return
+	}
+	if cfg.Chdir == nil {
+		app.Notify("no chdir function")
+		return
+	}
+	if cfg.Binding == nil {
+		cfg.Binding = cli.DummyHandler{}
+	}
+	l := newList(cfg.Bookmarks())
+
+	w := cli.NewComboBox(cli.ComboBoxSpec{
+		CodeArea: cli.CodeAreaSpec{
+			Prompt: cli.ModePrompt(" BOOKMARK ", true),
+		},
+		ListBox: cli.ListBoxSpec{
+			OverlayHandler: cfg.Binding,
+			OnAccept: func(it cli.Items, i int) {
+				err := cfg.Chdir(it.(list).bookmarks[i].Path)
+				if err != nil {
+					app.Notify(err.Error())
+				}
+				app.MutateState(func(s *cli.State) { s.Addon = nil })
+			},
+		},
+		OnFilter: func(w cli.ComboBox, p string) {
+			w.ListBox().Reset(l.filter(p), 0)
+		},
+	})
+	app.MutateState(func(s *cli.State) { s.Addon = w })
+	app.Redraw()
+}
+
+type list struct {
+	bookmarks []Bookmark
+	// Width of the column of names.
+	nameWidth int
+}
+
+func newList(bookmarks []Bookmark) list {
+	nameWidth := 0
+	for _, b := range bookmarks {
+		if w := wcwidth.Of(b.Name); w > nameWidth {
+			nameWidth = w
+		}
+	}
+	return list{bookmarks, nameWidth}
+}
+
+// Returns the bookmarks whose name or path contains p, ignoring case.
+func (l list) filter(p string) list {
+	if p == "" {
+		return l
+	}
+	p = strings.ToLower(p)
+	var filtered []Bookmark
+	for _, b := range l.bookmarks {
+		if strings.Contains(strings.ToLower(b.Name), p) ||
+			strings.Contains(strings.ToLower(fsutil.TildeAbbr(b.Path)), p) {
+			filtered = append(filtered, b)
+		}
+	}
+	l.bookmarks = filtered
+	return l
+}
+
+func (l list) Show(i int) ui.Text {
+	b := l.bookmarks[i]
+	padding := strings.Repeat(" ", l.nameWidth-wcwidth.Of(b.Name))
+	return ui.T(fmt.Sprintf("%s%s %s", b.Name, padding, fsutil.TildeAbbr(b.Path)))
+}
+
+func (l list) Len() int { return len(l.bookmarks) }
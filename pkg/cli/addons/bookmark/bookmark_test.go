@@ -0,0 +1,113 @@
+package bookmark
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/elves/elvish/pkg/cli"
+	. "github.com/elves/elvish/pkg/cli/clitest"
+	"github.com/elves/elvish/pkg/cli/term"
+	"github.com/elves/elvish/pkg/ui"
+)
+
+var bookmarks = []Bookmark{
+	{Name: "bin", Path: "/usr/bin"},
+	{Name: "temp", Path: "/tmp"},
+	{Name: "src", Path: "/usr/src"},
+}
+
+func TestStart_NoBookmarks(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	Start(f.App, Config{Chdir: func(string) error { return nil }})
+	f.TestTTYNotes(t, "no bookmarks")
+}
+
+func TestStart_NoChdir(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	Start(f.App, Config{Bookmarks: func() []Bookmark { return bookmarks }})
+	f.TestTTYNotes(t, "no chdir function")
+}
+
+func TestStart_OK(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	chdirCh := make(chan string, 100)
+	Start(f.App, Config{
+		Bookmarks: func() []Bookmark { return bookmarks },
+		Chdir:     func(path string) error { chdirCh <- path; return nil },
+	})
+
+	// Test UI.
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"bin  /usr/bin", "<- selected",
+		"temp /tmp",
+		"src  /usr/src"))
+
+	// Test filtering by path.
+	f.TTY.Inject(term.K('u'), term.K('s'), term.K('r'))
+	f.TTY.TestBuffer(t, listingBuf(
+		"usr",
+		"bin  /usr/bin", "<- selected",
+		"src  /usr/src"))
+
+	// Test filtering by name, ignoring case.
+	f.TTY.Inject(term.K(ui.Backspace), term.K(ui.Backspace), term.K(ui.Backspace),
+		term.K('T'), term.K('E'))
+	f.TTY.TestBuffer(t, listingBuf(
+		"TE",
+		"temp /tmp", "<- selected"))
+
+	// Test accepting.
+	f.TTY.Inject(term.K(ui.Enter))
+	f.TestTTY(t /* nothing */)
+	if got := <-chdirCh; got != "/tmp" {
+		t.Errorf("got chdir %q, want /tmp", got)
+	}
+}
+
+func TestStart_ChdirError(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	Start(f.App, Config{
+		Bookmarks: func() []Bookmark { return bookmarks },
+		Chdir:     func(string) error { return errors.New("mock chdir error") },
+	})
+	f.TTY.Inject(term.K(ui.Enter))
+	f.TestTTYNotes(t, "mock chdir error")
+}
+
+func TestStart_Binding(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	calledCh := make(chan struct{}, 1)
+	Start(f.App, Config{
+		Binding: cli.MapHandler{
+			term.K('a', ui.Ctrl): func() { calledCh <- struct{}{} },
+		},
+		Bookmarks: func() []Bookmark { return bookmarks },
+		Chdir:     func(string) error { return nil },
+	})
+	f.TTY.Inject(term.K('a', ui.Ctrl))
+	select {
+	case <-calledCh:
+		// OK
+	case <-time.After(time.Second):
+		t.Errorf("Handler not called after 1s")
+	}
+}
+
+func listingBuf(filter string, lines ...string) *term.Buffer {
+	b := term.NewBufferBuilder(50)
+	b.Newline() // empty code area
+	cli.WriteListing(b, " BOOKMARK ", filter, lines...)
+	return b.Buffer()
+}
@@ -0,0 +1,72 @@
+// Package confirm implements the confirm addon, which asks the user a yes/no
+// question in the modeline.
+package confirm
+
+import (
+	"github.com/elves/elvish/pkg/cli"
+	"github.com/elves/elvish/pkg/cli/term"
+	"github.com/elves/elvish/pkg/ui"
+)
+
+// Config keeps the configuration for the confirm addon.
+type Config struct {
+	// The question to show in the modeline.
+	Prompt string
+	// Called after the addon is closed when the user answers yes by pressing
+	// y.
+	OnYes func()
+	// Called after the addon is closed when the user answers no by pressing
+	// n or Escape.
+	OnNo func()
+}
+
+type widget struct {
+	app cli.App
+	Config
+}
+
+func (w *widget) Render(width, height int) *term.Buffer {
+	buf := term.NewBufferBuilder(width).
+		WriteStyled(cli.ModeLine(" CONFIRM ", true)).
+		Write(w.Prompt + " (y/n)").SetDotHere().Buffer()
+	buf.TrimToLines(0, height)
+	return buf
+}
+
+func (w *widget) Handle(event term.Event) bool {
+	switch event {
+	case term.K('y'), term.K('Y'):
+		w.close()
+		w.OnYes()
+	case term.K('n'), term.K('N'), term.K('[', ui.Ctrl):
+		w.close()
+		w.OnNo()
+	default:
+		return false
+	}
+	return true
+}
+
+func (w *widget) Focus() bool { return true }
+
+func (w *widget) close() {
+	w.app.MutateState(func(s *cli.State) {
+		if s.Addon == w {
+			s.Addon = nil
+		}
+	})
+	w.app.Redraw()
+}
+
+// Start starts the confirm addon.
+func Start(app cli.App, cfg Config) {
+	if cfg.OnYes == nil {
+		cfg.OnYes = func() {}
+	}
+	if cfg.OnNo == nil {
+		cfg.OnNo = func() {}
+	}
+	w := &widget{app, cfg}
+	app.MutateState(func(s *cli.State) { s.Addon = w })
+	app.Redraw()
+}
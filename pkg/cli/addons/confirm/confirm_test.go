@@ -0,0 +1,97 @@
+package confirm
+
+import (
+	"testing"
+
+	. "github.com/elves/elvish/pkg/cli/clitest"
+	"github.com/elves/elvish/pkg/cli/term"
+	"github.com/elves/elvish/pkg/ui"
+)
+
+func TestRendering(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	Start(f.App, Config{Prompt: "delete /tmp?"})
+	f.TestTTY(t,
+		"\n",
+		" CONFIRM ", Styles,
+		"*********",
+		" delete /tmp? (y/n)", term.DotHere,
+	)
+}
+
+var handlingTests = []struct {
+	name    string
+	key     term.Event
+	wantYes int
+	wantNo  int
+}{
+	{"y", term.K('y'), 1, 0},
+	{"Y", term.K('Y'), 1, 0},
+	{"n", term.K('n'), 0, 1},
+	{"N", term.K('N'), 0, 1},
+	{"Escape", term.K('[', ui.Ctrl), 0, 1},
+}
+
+func TestHandling(t *testing.T) {
+	for _, test := range handlingTests {
+		t.Run(test.name, func(t *testing.T) {
+			f := Setup()
+			defer f.Stop()
+
+			yes, no := 0, 0
+			Start(f.App, Config{
+				Prompt: "delete /tmp?",
+				OnYes:  func() { yes++ },
+				OnNo:   func() { no++ },
+			})
+			f.TTY.Inject(test.key)
+			f.TestTTY(t /* nothing */)
+			if yes != test.wantYes || no != test.wantNo {
+				t.Errorf("OnYes called %d times, OnNo called %d times, want %d and %d",
+					yes, no, test.wantYes, test.wantNo)
+			}
+			if addon := f.App.CopyState().Addon; addon != nil {
+				t.Errorf("addon is %v after answering, want nil", addon)
+			}
+		})
+	}
+}
+
+func TestHandling_OtherKeys(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	called := false
+	Start(f.App, Config{
+		Prompt: "delete /tmp?",
+		OnYes:  func() { called = true },
+		OnNo:   func() { called = true },
+	})
+	f.TTY.Inject(term.K('x'))
+	f.TestTTY(t,
+		"\n",
+		" CONFIRM ", Styles,
+		"*********",
+		" delete /tmp? (y/n)", term.DotHere,
+	)
+	if called {
+		t.Errorf("OnYes or OnNo called after pressing another key")
+	}
+	if _, ok := f.App.CopyState().Addon.(*widget); !ok {
+		t.Errorf("addon closed after pressing another key")
+	}
+}
+
+func TestHandling_NilCallbacks(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	Start(f.App, Config{Prompt: "delete /tmp?"})
+	f.TTY.Inject(term.K('y'))
+	f.TestTTY(t /* nothing */)
+	if addon := f.App.CopyState().Addon; addon != nil {
+		t.Errorf("addon is %v after answering, want nil", addon)
+	}
+}
@@ -23,6 +23,9 @@ type Config struct {
 	// CaseSensitive is called to determine whether the filter should be
 	// case-sensitive. Defaults to true if unset.
 	CaseSensitive func() bool
+	// OnlyFailed specifies whether to only show commands that have failed.
+	// When true, Store must also implement FailedStore.
+	OnlyFailed bool
 }
 
 // Store wraps the AllCmds method. It is a subset of histutil.Store.
@@ -32,6 +35,12 @@ type Store interface {
 
 var _ = Store(histutil.Store(nil))
 
+// FailedStore wraps the FailedCmds method, which returns all commands with a
+// recorded non-zero exit status.
+type FailedStore interface {
+	FailedCmds() ([]store.Cmd, error)
+}
+
 // Start starts history listing.
 func Start(app cli.App, cfg Config) {
 	if cfg.Store == nil {
@@ -45,7 +54,18 @@ func Start(app cli.App, cfg Config) {
 		cfg.CaseSensitive = func() bool { return true }
 	}
 
-	cmds, err := cfg.Store.AllCmds()
+	var cmds []store.Cmd
+	var err error
+	if cfg.OnlyFailed {
+		failedStore, ok := cfg.Store.(FailedStore)
+		if !ok {
+			app.Notify("history store doesn't record exit status")
+			return
+		}
+		cmds, err = failedStore.FailedCmds()
+	} else {
+		cmds, err = cfg.Store.AllCmds()
+	}
 	if err != nil {
 		app.Notify("db error: " + err.Error())
 	}
@@ -58,6 +78,9 @@ func Start(app cli.App, cfg Config) {
 	w := cli.NewComboBox(cli.ComboBoxSpec{
 		CodeArea: cli.CodeAreaSpec{Prompt: func() ui.Text {
 			content := " HISTORY "
+			if cfg.OnlyFailed {
+				content += "(failed) "
+			}
 			if cfg.Dedup() {
 				content += "(dedup on) "
 			}
@@ -3,6 +3,7 @@ package histlist
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/elves/elvish/pkg/cli"
@@ -73,6 +74,47 @@ func TestStart_OK(t *testing.T) {
 		"\n", "baz2", term.DotHere)
 }
 
+// A store with exit status of commands, where commands whose text contains
+// "fail" have failed.
+type failedStore struct{ histutil.Store }
+
+func (s failedStore) FailedCmds() ([]store.Cmd, error) {
+	cmds, err := s.AllCmds()
+	var failed []store.Cmd
+	for _, cmd := range cmds {
+		if strings.Contains(cmd.Text, "fail") {
+			failed = append(failed, cmd)
+		}
+	}
+	return failed, err
+}
+
+func TestStart_OnlyFailed(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	st := failedStore{histutil.NewMemStore(
+		// 0      1      2        3
+		"fail1", "ok1", "fail2", "ok2")}
+	Start(f.App, Config{Store: st, OnlyFailed: true})
+	f.TTY.TestBuffer(t,
+		makeListingBuf(
+			" HISTORY (failed) (dedup on) ", "",
+			"   0 fail1",
+			"   2 fail2"))
+
+	f.TTY.Inject(term.K(ui.Enter))
+	f.TestTTY(t, "fail2", term.DotHere)
+}
+
+func TestStart_OnlyFailed_Unsupported(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	Start(f.App, Config{Store: histutil.NewMemStore("foo"), OnlyFailed: true})
+	f.TestTTYNotes(t, "history store doesn't record exit status")
+}
+
 func TestStart_Dedup(t *testing.T) {
 	f := Setup()
 	defer f.Stop()
@@ -0,0 +1,38 @@
+package location
+
+import (
+	"io/ioutil"
+	"strings"
+)
+
+// Reads the glob patterns from an ignore file, one per line. Blank lines and
+// lines starting with # are skipped. If the file can't be read, for example
+// because it doesn't exist, there are no patterns.
+func readIgnoreFile(name string) []string {
+	if name == "" {
+		return nil
+	}
+	content, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil
+	}
+	var patterns []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns
+}
+
+// Returns whether path or any of its ancestors matches any of the patterns.
+func ignored(path string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if underGlob(path, pattern) {
+			return true
+		}
+	}
+	return false
+}
@@ -3,17 +3,24 @@
 package location
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/elves/elvish/pkg/cli"
+	"github.com/elves/elvish/pkg/cli/term"
 	"github.com/elves/elvish/pkg/fsutil"
 	"github.com/elves/elvish/pkg/store"
 	"github.com/elves/elvish/pkg/ui"
+	"github.com/elves/elvish/pkg/wcwidth"
 )
 
 // Config is the configuration to start the location history feature.
@@ -22,6 +29,14 @@ type Config struct {
 	Binding cli.Handler
 	// Store provides the directory history and the function to change directory.
 	Store Store
+	// Stores are additional stores to read the directory history from, along
+	// with Store, which may be nil if Stores is not empty. Directories with the
+	// same path from different stores are merged, with their scores summed.
+	// Changing directory is attempted with each store in turn, starting from
+	// Store, until one succeeds. The working directory is taken from the first
+	// store. Visit times are merged from all the stores that implement
+	// TimeStore, keeping the latest time of each directory.
+	Stores []Store
 	// IteratePinned specifies pinned directories by calling the given function
 	// with all pinned directories.
 	IteratePinned func(func(string))
@@ -30,8 +45,296 @@ type Config struct {
 	IterateHidden func(func(string))
 	// IterateWorksapce specifies workspace configuration.
 	IterateWorkspaces WorkspaceIterator
+	// Filter is called with the filter query and the path of a directory
+	// (abbreviated with ~) to determine whether the directory should be shown.
+	// If nil, each segment of the query separated by the path separator is
+	// matched as a substring, ignoring case, and all the occurrences of the
+	// segments in the shown paths are highlighted.
+	Filter func(query, path string) bool
+	// Rank is called with the directories from the store, after hidden
+	// directories have been excluded, and returns the directories to show in
+	// the order they should be shown. Pinned directories are not passed to Rank
+	// and are always shown first. If nil, the order from the store is kept.
+	Rank func([]store.Dir) []store.Dir
+	// NavigationBinding is the key binding of the navigation addon, which is
+	// started when Tab is pressed. Since the navigation addon always starts in
+	// the working directory, the selected directory is changed to first, with
+	// Accept and PushUndo like when accepting it. If nil, Tab is not bound.
+	NavigationBinding cli.Handler
+	// Accept is called with the path of the accepted directory. If nil,
+	// Store.Chdir is called instead.
+	Accept func(path string) error
+	// PushUndo, if not nil, is called with the working directory from before
+	// accepting a directory when accepting succeeds, so that it can be
+	// recorded for going back later. It is not called in the multi-select
+	// mode, or if the working directory can't be determined.
+	PushUndo func(prev string)
+	// InitialFilter is the initial content of the filter.
+	InitialFilter string
+	// RememberFilter specifies whether the filter should be remembered when the
+	// addon is closed. If true and InitialFilter is empty, the filter from the
+	// last time the addon was started with RememberFilter is used.
+	RememberFilter bool
+	// MaxEntries is the maximum number of directories to show. Filtering is
+	// done before the truncation, so directories beyond the limit can still be
+	// reached by filtering. If zero, all directories are shown.
+	MaxEntries int
+	// SavePinned is called with all the pinned directories after they have
+	// been reordered with Alt-Up and Alt-Down. If nil, pinned directories
+	// cannot be reordered.
+	SavePinned func([]string) error
+	// AbsolutePaths specifies whether paths should be shown as is, instead of
+	// abbreviating the home directory to ~.
+	AbsolutePaths bool
+	// DeleteEntry is called with the path of the selected directory when
+	// Alt-Backspace is pressed. If it succeeds, the directory is removed from
+	// the list. If nil, directories cannot be deleted.
+	DeleteEntry func(path string) error
+	// Pin is called with the path of the selected directory when Alt-P is
+	// pressed. If it succeeds, the directory is shown as pinned at the top of
+	// the list. If nil, directories cannot be pinned.
+	Pin func(path string) error
+	// ToggleOrder specifies whether Alt-S toggles between ordering the
+	// directories by score and by path.
+	ToggleOrder bool
+	// PruneMissing specifies whether directories that no longer exist should
+	// be hidden. Pinned directories are always shown.
+	PruneMissing bool
+	// StatTimeout is the maximum amount of time to wait when checking whether
+	// a directory exists. Directories that can't be checked within this time
+	// are assumed to exist. If zero, there is no timeout.
+	StatTimeout time.Duration
+	// IgnoreCase specifies whether the filter query and paths should be
+	// converted to lower case before being passed to Filter. The default
+	// matcher used when Filter is nil always ignores case.
+	IgnoreCase bool
+	// Glob, if non-empty, restricts the directories from the store to those
+	// under a directory matching the glob pattern, using the syntax of
+	// filepath.Match. The pattern may start with ~ to match directories under
+	// the home directory. Pinned directories are not affected. When
+	// PruneMissing is also true, only directories matching the glob are
+	// checked for existence.
+	Glob string
+	// MultiSelect specifies whether multiple directories can be selected. When
+	// true, Space marks or unmarks the selected directory, and accepting calls
+	// AcceptMulti with the paths of all marked directories, or the selected
+	// directory if none is marked.
+	MultiSelect bool
+	// AcceptMulti is called when accepting in the multi-select mode. It must
+	// be set if MultiSelect is true.
+	AcceptMulti func([]string) error
+	// ShowCwd specifies whether to show the working directory as the first
+	// entry, marked with "cwd" instead of a score.
+	ShowCwd bool
+	// ExcludeCwd specifies whether to hide the working directory even if it is
+	// pinned. The working directory is never listed from the history anyway.
+	// When true, ShowCwd has no effect.
+	ExcludeCwd bool
+	// ScoreWidth is the width of the column of scores. If zero, the width is
+	// 3, and wider scores are not truncated. If negative, the width is the
+	// minimal one that fits all the scores.
+	ScoreWidth int
+	// StayOpenOnError specifies whether the addon stays open when accepting a
+	// directory fails, so that another directory can be picked.
+	StayOpenOnError bool
+	// Regex specifies whether the filter is interpreted as a regular
+	// expression, matched against the shown paths. The first match in each
+	// path is highlighted. While the filter is not a valid regular expression,
+	// all directories are shown. If IgnoreCase is also true, the regular
+	// expression is matched case-insensitively. Filter is not used when Regex
+	// is true.
+	Regex bool
+	// MatchBasenameOnly specifies whether the filter is only matched against
+	// the base names of the shown paths, instead of the full paths. It applies
+	// to Filter, the default matcher and Regex alike.
+	MatchBasenameOnly bool
+	// Preview, if not nil, is called with the path of the selected directory
+	// to get the content of a preview pane, which is shown below the list and
+	// takes up to half of the available height. It is only called when the
+	// preview is shown, and the result is cached for each path.
+	Preview func(path string) ui.Text
+	// Extra, if not nil, is called to get transient directories that are not
+	// in the store, like git worktrees or mounted volumes. They are merged with
+	// the directories from the store by score before ranking, and treated like
+	// them afterwards. Directories that are hidden are ignored, and those that
+	// are already in the store are deduplicated according to Dedup.
+	Extra func() []store.Dir
+	// ModeLine is the text shown in the mode line. If empty, "LOCATION" is
+	// used.
+	ModeLine string
+	// Now returns the current time, for the features that depend on it, so
+	// that they can be tested with a fixed clock. If nil, time.Now is used.
+	Now func() time.Time
+	// Confirm specifies whether accepting a directory needs to be confirmed.
+	// When true, the first Enter shows the absolute path of the selected
+	// directory, with symlinks resolved, in the mode line, and a second Enter
+	// accepts it. Escape cancels the confirmation. Confirm has no effect in the
+	// multi-select mode.
+	Confirm bool
+	// OpenInEditor is called with the path of the selected directory when
+	// Alt-E is pressed, after which the addon is closed. If nil, Alt-E is not
+	// bound.
+	OpenInEditor func(path string) error
+	// CopyPath is called with the path of the selected directory when Alt-C is
+	// pressed, typically to copy it to the clipboard. The addon stays open. If
+	// nil, Alt-C is not bound.
+	CopyPath func(path string) error
+	// AcceptWith maps keys to actions on the selected directory. When one of
+	// the keys is pressed, its action is called with the path of the selected
+	// directory, after which the addon is closed; if the action returns an
+	// error, it is shown as a note. The keys take precedence over the builtin
+	// ones, including Enter.
+	AcceptWith map[ui.Key]func(path string) error
+	// CancelKeys are keys that close the addon without accepting any
+	// directory, like Escape does in the default binding of the editor. They
+	// take precedence over the builtin keys.
+	CancelKeys []ui.Key
+	// IgnoreFile, if not empty, is the path of a file with glob patterns, one
+	// per line, using the same syntax as Glob. Directories from the store and
+	// Extra that are under a directory matching any of the patterns are not
+	// shown. Blank lines and lines starting with # are skipped. The file is
+	// read each time the addon is started; if it can't be read, nothing is
+	// ignored. Pinned directories are not affected.
+	IgnoreFile string
+	// GroupByParent specifies whether the shown directories are grouped by
+	// their parent directories. Each group is preceded by a header showing the
+	// parent directory, which can't be selected, and the directories in the
+	// group are shown by their base names. Groups are in the order of their
+	// first directories.
+	GroupByParent bool
+	// SplitFrequentRecent specifies whether the shown directories are split
+	// into a "frequent" section and a "recent" section, each preceded by a
+	// header that can't be selected. The recent section has the directories
+	// visited in the last 24 hours, most recent first; the frequent section
+	// has the rest, in the usual order. Visit times come from the store,
+	// which must implement TimeStore; otherwise all directories are in the
+	// frequent section. This has no effect when grouping by parent or
+	// ordering by path.
+	SplitFrequentRecent bool
+	// Blacklist, if not nil, is called with the path of each directory from the
+	// store and those from Extra, after workspace-relative paths are expanded,
+	// and directories for which it returns true are not shown. It is applied in
+	// addition to the exact paths excluded by IterateHidden and the working
+	// directory, which are excluded first. Pinned directories are not
+	// affected.
+	Blacklist func(path string) bool
+	// OnEmpty, if not nil, is called with the filter query whenever filtering
+	// leaves no directories to show. Regardless of OnEmpty, a "no matches"
+	// note is shown in that case.
+	OnEmpty func(query string)
+	// ChdirTimeout is the maximum amount of time to wait for accepting a
+	// directory, which may hang when the directory is on an unresponsive
+	// network mount. On timeout, a note is shown and the addon stays open. If
+	// zero, there is no timeout.
+	ChdirTimeout time.Duration
+	// PinnedMarker is shown in place of the score of pinned directories. If
+	// empty, "*" is used. The column of scores is aligned by the display width
+	// of the marker, so it may contain wide characters.
+	PinnedMarker string
+	// QuickJump specifies whether typed characters move the selection instead
+	// of being inserted into the filter. The typed characters are accumulated,
+	// and the selection moves to the next directory whose base name starts
+	// with them, ignoring case. The accumulated characters are reset when no
+	// character has been typed for quickJumpReset.
+	QuickJump bool
+	// Dedup specifies how directories with the same path, from the store or
+	// from Extra, are deduplicated. If empty, KeepFirst is used.
+	Dedup Dedup
+	// ShowTime specifies whether to show when each directory was last visited,
+	// in a right-aligned column after the scores. It requires Store to
+	// implement TimeStore; otherwise the column is not shown.
+	ShowTime bool
+	// FormatTime formats the time when a directory was last visited. If nil,
+	// the time is shown relative to the current time, like "2d ago".
+	FormatTime func(time.Time) string
+	// ViKeys specifies whether to use vi-style keys. When true, typed
+	// characters don't go to the filter; j and k move the selection instead,
+	// and / starts filtering, which Escape stops. See cli.ComboBoxSpec.
+	ViKeys bool
+	// WrapSelection specifies whether moving the selection past the last
+	// directory selects the first one, and vice versa.
+	WrapSelection bool
+	// ShowScrollbar specifies whether the position of the selected entry and
+	// the number of entries are shown below the list when not all of them
+	// fit. See cli.ListBoxSpec.ShowScrollbar. Group headers are counted.
+	ShowScrollbar bool
+	// SelectedStyle is the styling of the selected directory. If nil, the
+	// selected directory is shown in inverse video.
+	SelectedStyle ui.Styling
+	// Watch, if not nil, is a channel on which a value is sent when the
+	// directories in the store may have changed. When that happens, the
+	// directories are loaded again while keeping the filter, and the selected
+	// directory is kept if it is still shown. Watching stops when the channel
+	// is closed, or when a value is received after the addon is closed.
+	Watch <-chan struct{}
+	// MaxPathLen, if positive, is the maximal width of the shown paths. Longer
+	// paths are shortened like when they don't fit in the terminal, by
+	// replacing path components in the middle with "…", and if that is not
+	// enough, by replacing characters in the middle with "…". The full paths
+	// are still used for filtering and accepting.
+	MaxPathLen int
+	// InitialPath, if not empty, is the path of the directory that is selected
+	// when the directories are loaded, if it is shown. Otherwise the first
+	// directory is selected as usual.
+	InitialPath string
+	// SmartRank specifies whether directories matching a non-empty filter are
+	// re-ranked by blending their scores with how well they match. The score
+	// of a directory is multiplied by 4 if its base name starts with the last
+	// segment of the filter, by 2 if its base name contains it, and by 1
+	// otherwise, ignoring case. Pinned directories and the working directory
+	// stay first. SmartRank has no effect when ordering by path.
+	SmartRank bool
+	// NoStoreMessage is the note shown when there is no store. Defaults to
+	// "no dir history store".
+	NoStoreMessage string
+	// ErrorPrefix is prepended to errors from the store when they are shown
+	// as notes. Defaults to "db error: ".
+	ErrorPrefix string
+	// FilterDebounce, if positive, is how long filtering waits after the
+	// filter query changes, so that typing quickly only filters once. The
+	// query itself is always shown immediately.
+	FilterDebounce time.Duration
+	// Abbreviations are applied to the shown paths. A path under the Prefix of
+	// an abbreviation is shown with the prefix replaced by the Replacement;
+	// if several prefixes match, the longest one wins, and among prefixes of
+	// the same length, the earliest one. Paths without a matching prefix are
+	// shown as usual. Like ~, abbreviations also apply to the paths matched
+	// against the filter, while the full paths are still used for accepting.
+	Abbreviations []Abbreviation
+	// SuppressRecent, if positive, is the number of most recently accepted
+	// directories that are hidden while the filter is empty. They are still
+	// shown when they match a non-empty filter. Pinned directories and the
+	// working directory are never hidden.
+	SuppressRecent int
+	// NoColor specifies whether the mode line should be shown without colors,
+	// for terminals without color support. The directories are never colored,
+	// and other styles, like the inverse of the selected directory, are kept.
+	NoColor bool
+	// ColorByScore specifies whether scores should be styled according to
+	// how high they are relative to the highest score among the shown
+	// directories, from dim for the lowest to bright for the highest. It has no
+	// effect when NoColor is true.
+	ColorByScore bool
 }
 
+// Abbreviation specifies how paths under a directory are shortened when shown.
+type Abbreviation struct {
+	Prefix, Replacement string
+}
+
+// Dedup specifies how directories with the same path are deduplicated. In all
+// modes, the kept directory takes the position of the first one with the path.
+type Dedup string
+
+const (
+	// KeepFirst keeps the first directory with each path, where directories
+	// from the store come before those from Config.Extra.
+	KeepFirst Dedup = "keep-first"
+	// KeepHighestScore keeps the directory with the highest score among those
+	// with each path, preferring the first one on ties.
+	KeepHighestScore Dedup = "keep-highest-score"
+)
+
 // Store defines the interface for interacting with the directory history.
 type Store interface {
 	Dirs(blacklist map[string]struct{}) ([]store.Dir, error)
@@ -39,22 +342,212 @@ type Store interface {
 	Getwd() (string, error)
 }
 
+// ContextStore is an optional interface that a Store may implement to support
+// canceling the query of directories. The addon cancels the context when it is
+// closed before the query finishes, either by its own keys or by Binding.
+type ContextStore interface {
+	Store
+	// DirsContext is like Dirs, but should give up and return ctx.Err() when
+	// ctx is canceled.
+	DirsContext(ctx context.Context, blacklist map[string]struct{}) ([]store.Dir, error)
+}
+
+// Calls DirsContext if s implements ContextStore, and Dirs otherwise.
+func dirsContext(ctx context.Context, s Store, blacklist map[string]struct{}) ([]store.Dir, error) {
+	if cs, ok := s.(ContextStore); ok {
+		return cs.DirsContext(ctx, blacklist)
+	}
+	return s.Dirs(blacklist)
+}
+
+// DecayStore is an optional interface that a Store may implement to support
+// decaying the scores of directories, so that directories visited long ago
+// rank lower.
+type DecayStore interface {
+	Store
+	// DecayScores multiplies the scores of all directories by factor.
+	DecayScores(factor float64) error
+}
+
+// DecayScores decays the scores of the directories in the store by factor. It
+// returns an error if the store doesn't implement DecayStore.
+func DecayScores(st Store, factor float64) error {
+	if st == nil {
+		return errNoStore
+	}
+	ds, ok := st.(DecayStore)
+	if !ok {
+		return errNoDecay
+	}
+	return ds.DecayScores(factor)
+}
+
+// BumpStore is an optional interface that a Store may implement to support
+// bumping the score of a directory without changing to it, so that it becomes
+// easier to reach later.
+type BumpStore interface {
+	Store
+	// Bump increases the score of the directory as if it had been visited.
+	Bump(path string) error
+}
+
+// Bump bumps the score of the directory with the given path in the store. It
+// returns an error if the store doesn't implement BumpStore.
+func Bump(st Store, path string) error {
+	if st == nil {
+		return errNoStore
+	}
+	bs, ok := st.(BumpStore)
+	if !ok {
+		return errNoBump
+	}
+	return bs.Bump(path)
+}
+
+// TimeStore is an optional interface that a Store may implement to provide the
+// times when directories were last visited, which are shown when
+// Config.ShowTime is true.
+type TimeStore interface {
+	Store
+	// VisitTimes returns the times when directories were last visited, keyed
+	// by their paths. Directories whose times are unknown may be missing or
+	// have zero times, as is the case with stores written by older versions.
+	VisitTimes() (map[string]time.Time, error)
+}
+
 // A special score for pinned directories.
 var pinnedScore = math.Inf(1)
 
-// Start starts the directory history feature.
-func Start(app cli.App, cfg Config) {
+// A special score for the working directory, shown when Config.ShowCwd is
+// true.
+var cwdScore = math.Inf(-1)
+
+// The last filter, saved when Config.RememberFilter is true. It is written when
+// filtering, which may happen in a goroutine when Config.FilterDebounce is
+// positive.
+var lastFilter struct {
+	sync.Mutex
+	query string
+}
+
+// Saves query as the last filter.
+func setLastFilter(query string) {
+	lastFilter.Lock()
+	defer lastFilter.Unlock()
+	lastFilter.query = query
+}
+
+// Returns the last filter.
+func getLastFilter() string {
+	lastFilter.Lock()
+	defer lastFilter.Unlock()
+	return lastFilter.query
+}
+
+// The most recently accepted directories, most recent first, saved when
+// Config.SuppressRecent is positive.
+var recentlyAccepted struct {
+	sync.Mutex
+	paths []string
+}
+
+// Records that path has been accepted, keeping at most n paths.
+func addRecentlyAccepted(path string, n int) {
+	recentlyAccepted.Lock()
+	defer recentlyAccepted.Unlock()
+	paths := []string{path}
+	for _, p := range recentlyAccepted.paths {
+		if len(paths) == n {
+			break
+		}
+		if p != path {
+			paths = append(paths, p)
+		}
+	}
+	recentlyAccepted.paths = paths
+}
+
+// Returns the n most recently accepted directories.
+func getRecentlyAccepted(n int) map[string]bool {
+	recentlyAccepted.Lock()
+	defer recentlyAccepted.Unlock()
+	paths := map[string]bool{}
+	for i, p := range recentlyAccepted.paths {
+		if i == n {
+			break
+		}
+		paths[p] = true
+	}
+	return paths
+}
+
+// How long the characters typed with Config.QuickJump are accumulated for.
+const quickJumpReset = time.Second
+
+// Directories visited within this duration are in the recent section when
+// splitting frequent and recent directories.
+const recentWindow = 24 * time.Hour
+
+// Calls f after d in its own goroutine, returning a function that cancels the
+// call; can be overridden in tests.
+var afterFunc = func(d time.Duration, f func()) (stop func() bool) {
+	return time.AfterFunc(d, f).Stop
+}
+
+var (
+	errChdirTimeout = errors.New("chdir timed out")
+	errNoStore      = errors.New("no dir history store")
+	errNoDecay      = errors.New("dir history store doesn't support decaying scores")
+	errNoBump       = errors.New("dir history store doesn't support bumping scores")
+	errNoMatch      = errors.New("no matching directory")
+)
+
+// Rankings returns the directories that the location addon shows when started
+// with the given configuration, in the order they are shown. If the store
+// returns an error, the error is returned along with the pinned directories and
+// the working directory if Config.ShowCwd is true.
+func Rankings(cfg Config) ([]store.Dir, error) {
+	dirs, _, err := rankings(context.Background(), cfg)
+	return dirs, err
+}
+
+// Select returns the path of the directory that the location addon would
+// select first when started with the given configuration and filtered with
+// the given query, without showing any UI. If there are several matches, the
+// top-ranked one is returned; if there are none, an error is returned.
+func Select(cfg Config, query string) (string, error) {
+	dirs, ws, err := rankings(context.Background(), cfg)
+	if err != nil && len(dirs) == 0 {
+		return "", err
+	}
+	l := list{dirs: dirs, showPath: makeShowPath(cfg), matchBase: cfg.MatchBasenameOnly}
+	l = l.filterQuery(query, cfg)
+	if cfg.SmartRank {
+		l = l.smartRank(query)
+	}
+	if len(l.dirs) == 0 {
+		return "", errNoMatch
+	}
+	return ws.expand(l.dirs[0].Path), nil
+}
+
+func rankings(ctx context.Context, cfg Config) ([]store.Dir, workspace, error) {
+	combineStores(&cfg)
 	if cfg.Store == nil {
-		app.Notify("no dir history store")
-		return
+		return nil, workspace{}, errNoStore
 	}
 
 	dirs := []store.Dir{}
 	blacklist := map[string]struct{}{}
-	wsKind, wsRoot := "", ""
+	pinned := map[string]bool{}
+	var ws workspace
 
 	if cfg.IteratePinned != nil {
 		cfg.IteratePinned(func(s string) {
+			if pinned[s] {
+				return
+			}
+			pinned[s] = true
 			blacklist[s] = struct{}{}
 			dirs = append(dirs, store.Dir{Score: pinnedScore, Path: s})
 		})
@@ -62,54 +555,274 @@ func Start(app cli.App, cfg Config) {
 	if cfg.IterateHidden != nil {
 		cfg.IterateHidden(func(s string) { blacklist[s] = struct{}{} })
 	}
-	wd, err := cfg.Store.Getwd()
-	if err == nil {
+	wd, wdErr := cfg.Store.Getwd()
+	if wdErr == nil {
 		blacklist[wd] = struct{}{}
 		if cfg.IterateWorkspaces != nil {
-			wsKind, wsRoot = cfg.IterateWorkspaces.Parse(wd)
+			ws.kind, ws.root = cfg.IterateWorkspaces.Parse(wd)
 		}
 	}
-	storedDirs, err := cfg.Store.Dirs(blacklist)
-	if err != nil {
-		app.Notify("db error: " + err.Error())
-		if len(dirs) == 0 {
-			return
-		}
+
+	storedDirs, storeErr := dirsContext(ctx, cfg.Store, blacklist)
+	if cfg.Extra != nil {
+		storedDirs = mergeExtra(storedDirs, cfg.Extra(), blacklist, cfg.Dedup)
+	} else {
+		storedDirs = dedup(storedDirs, cfg.Dedup)
 	}
+	ignores := readIgnoreFile(cfg.IgnoreFile)
+	var shownDirs []store.Dir
 	for _, dir := range storedDirs {
-		if filepath.IsAbs(dir.Path) {
-			dirs = append(dirs, dir)
-		} else if wsKind != "" && hasPathPrefix(dir.Path, wsKind) {
-			dirs = append(dirs, dir)
+		// The store may not honor the blacklist; a pinned directory is only
+		// shown once, as pinned.
+		if pinned[dir.Path] {
+			continue
 		}
+		if !filepath.IsAbs(dir.Path) &&
+			!(ws.kind != "" && hasPathPrefix(dir.Path, ws.kind)) {
+			continue
+		}
+		if cfg.Glob != "" && !underGlob(ws.expand(dir.Path), cfg.Glob) {
+			continue
+		}
+		if cfg.Blacklist != nil && cfg.Blacklist(ws.expand(dir.Path)) {
+			continue
+		}
+		if ignored(ws.expand(dir.Path), ignores) {
+			continue
+		}
+		shownDirs = append(shownDirs, dir)
 	}
+	if cfg.Rank != nil {
+		shownDirs = cfg.Rank(shownDirs)
+	}
+	if cfg.PruneMissing {
+		shownDirs = pruneMissing(shownDirs, ws.expand, cfg.StatTimeout)
+	}
+	dirs = append(dirs, shownDirs...)
+	if (cfg.ShowCwd || cfg.ExcludeCwd) && wdErr == nil {
+		// The working directory may be pinned, or returned by a store that
+		// doesn't honor the blacklist; don't show it twice.
+		if i := indexOfPath(dirs, wd); i != -1 {
+			dirs = append(dirs[:i:i], dirs[i+1:]...)
+		}
+		if !cfg.ExcludeCwd {
+			dirs = append([]store.Dir{{Path: wd, Score: cwdScore}}, dirs...)
+		}
+	}
+	return dirs, ws, storeErr
+}
 
-	l := list{dirs}
-
-	w := cli.NewComboBox(cli.ComboBoxSpec{
-		CodeArea: cli.CodeAreaSpec{
-			Prompt: cli.ModePrompt(" LOCATION ", true),
-		},
-		ListBox: cli.ListBoxSpec{
-			OverlayHandler: cfg.Binding,
-			OnAccept: func(it cli.Items, i int) {
-				path := it.(list).dirs[i].Path
-				if strings.HasPrefix(path, wsKind) {
-					path = wsRoot + path[len(wsKind):]
-				}
-				err := cfg.Store.Chdir(path)
-				if err != nil {
-					app.Notify(err.Error())
-				}
-				app.MutateState(func(s *cli.State) { s.Addon = nil })
-			},
-		},
-		OnFilter: func(w cli.ComboBox, p string) {
-			w.ListBox().Reset(l.filter(p), 0)
-		},
+// Merges extra directories into dirs, deduplicating them according to mode and
+// keeping the result sorted by score in descending order. Extra directories
+// that are in blacklist are ignored.
+func mergeExtra(dirs, extra []store.Dir, blacklist map[string]struct{}, mode Dedup) []store.Dir {
+	merged := append([]store.Dir(nil), dirs...)
+	for _, dir := range extra {
+		if _, hidden := blacklist[dir.Path]; !hidden {
+			merged = append(merged, dir)
+		}
+	}
+	merged = dedup(merged, mode)
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Score > merged[j].Score
 	})
-	app.MutateState(func(s *cli.State) { s.Addon = w })
+	return merged
+}
+
+// Removes directories with duplicate paths from dirs according to mode.
+func dedup(dirs []store.Dir, mode Dedup) []store.Dir {
+	index := make(map[string]int, len(dirs))
+	var deduped []store.Dir
+	for _, dir := range dirs {
+		i, seen := index[dir.Path]
+		if !seen {
+			index[dir.Path] = len(deduped)
+			deduped = append(deduped, dir)
+		} else if mode == KeepHighestScore && dir.Score > deduped[i].Score {
+			deduped[i] = dir
+		}
+	}
+	return deduped
+}
+
+// The kind and root of the workspace the working directory is in.
+type workspace struct{ kind, root string }
+
+// Expands a workspace-relative path into an absolute one.
+func (ws workspace) expand(path string) string {
+	if strings.HasPrefix(path, ws.kind) {
+		return ws.root + path[len(ws.kind):]
+	}
+	return path
+}
+
+// Start starts the directory history feature. The directories are loaded in the
+// background; until they are loaded, a placeholder is shown. Panics in the
+// callbacks in cfg are shown as notes instead of crashing the app.
+func Start(app cli.App, cfg Config) {
+	cli.CatchPanic(app, func() { start(app, cfg) })
+}
+
+func start(app cli.App, cfg Config) {
+	combineStores(&cfg)
+	if cfg.NoStoreMessage == "" {
+		cfg.NoStoreMessage = errNoStore.Error()
+	}
+	if cfg.ErrorPrefix == "" {
+		cfg.ErrorPrefix = "db error: "
+	}
+	if cfg.Store == nil {
+		app.Notify(cfg.NoStoreMessage)
+		return
+	}
+	if cfg.Binding == nil {
+		cfg.Binding = cli.DummyHandler{}
+	}
+	if cfg.Accept == nil {
+		cfg.Accept = cfg.Store.Chdir
+	}
+	if cfg.ModeLine == "" {
+		cfg.ModeLine = "LOCATION"
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+
+	w := newWidget(app, cfg)
+	app.MutateState(func(s *cli.State) { s.Addon = w.addon })
 	app.Redraw()
+	go w.loadAndWatch()
+}
+
+// A ComboBox with a preview pane for the selected directory below it.
+type previewWidget struct {
+	cli.ComboBox
+	app cli.App
+	// Returns the path of the selected directory, and whether there is one.
+	selected func() (string, bool)
+	preview  func(path string) ui.Text
+	cache    map[string]ui.Text
+}
+
+// Render renders the combobox in the upper half of the height, and the preview
+// of the selected directory below it.
+func (w *previewWidget) Render(width, height int) *term.Buffer {
+	previewHeight := height / 2
+	buf := w.ComboBox.Render(width, height-previewHeight)
+	path, ok := w.selected()
+	if !ok || previewHeight == 0 {
+		return buf
+	}
+	content, cached := w.cache[path]
+	if !cached {
+		// A panicking preview is shown as a note once, and an empty preview
+		// is cached in its place.
+		cli.CatchPanic(w.app, func() { content = w.preview(path) })
+		w.cache[path] = content
+	}
+	buf.Extend(cli.Label{Content: content}.Render(width, previewHeight), false)
+	return buf
+}
+
+// Calls f and returns its error. If timeout is positive and f doesn't return
+// within it, errChdirTimeout is returned instead, leaving f running.
+func callWithTimeout(f func() error, timeout time.Duration) error {
+	if timeout <= 0 {
+		return f()
+	}
+	errCh := make(chan error, 1)
+	go func() { errCh <- f() }()
+	select {
+	case err := <-errCh:
+		return err
+	case <-time.After(timeout):
+		return errChdirTimeout
+	}
+}
+
+// Returns the absolute form of path with symlinks resolved.
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// Returns whether path or any of its ancestors matches the glob pattern, either
+// as is or with the home directory abbreviated to ~.
+func underGlob(path, pattern string) bool {
+	for {
+		if matchGlob(pattern, path) || matchGlob(pattern, fsutil.TildeAbbr(path)) {
+			return true
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return false
+		}
+		path = parent
+	}
+}
+
+func matchGlob(pattern, path string) bool {
+	matched, err := filepath.Match(pattern, path)
+	return err == nil && matched
+}
+
+func fixIndex(i, n int) int {
+	switch {
+	case i >= n:
+		return n - 1
+	case i < 0:
+		return 0
+	default:
+		return i
+	}
+}
+
+func (l list) markedPaths() []string {
+	var paths []string
+	for _, dir := range l.dirs {
+		if l.marked[dir.Path] {
+			paths = append(paths, dir.Path)
+		}
+	}
+	return paths
+}
+
+func indexOfPath(dirs []store.Dir, path string) int {
+	for i, dir := range dirs {
+		if dir.Path == path {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns the function converting paths to the form that is shown, according to
+// cfg.AbsolutePaths and cfg.Abbreviations.
+func makeShowPath(cfg Config) func(string) string {
+	fallback := fsutil.TildeAbbr
+	if cfg.AbsolutePaths {
+		fallback = func(path string) string { return path }
+	}
+	if len(cfg.Abbreviations) == 0 {
+		return fallback
+	}
+	abbrs := cfg.Abbreviations
+	return func(path string) string {
+		best := -1
+		for i, abbr := range abbrs {
+			if hasPathPrefix(path, abbr.Prefix) &&
+				(best == -1 || len(abbr.Prefix) > len(abbrs[best].Prefix)) {
+				best = i
+			}
+		}
+		if best == -1 {
+			return fallback(path)
+		}
+		return abbrs[best].Replacement + path[len(abbrs[best].Prefix):]
+	}
 }
 
 func hasPathPrefix(path, prefix string) bool {
@@ -147,20 +860,334 @@ func (ws WorkspaceIterator) Parse(path string) (kind, root string) {
 
 type list struct {
 	dirs []store.Dir
+	// Number of directories truncated from the end of dirs. When positive, a
+	// note is shown after all the directories.
+	more int
+	// Converts a path to the form that is shown and matched against the filter.
+	showPath func(string) string
+	// Whether only the base names of the shown paths are matched against the
+	// filter.
+	matchBase bool
+	// The maximal width of shown paths; no limit if not positive.
+	maxPathLen int
+	// Paths of marked directories in the multi-select mode; nil otherwise.
+	// Since copies of the list are rendered concurrently, the map is never
+	// modified; marking replaces it.
+	marked map[string]bool
+	// Whether the directories are still being loaded.
+	loading bool
+	// Width of the column of scores.
+	scoreWidth int
+	// Whether scores are styled by how high they are, and the highest score
+	// of the shown directories they are relative to.
+	colorByScore bool
+	maxScore     float64
+	// Shown in place of the score of pinned directories.
+	pinnedMarker string
+	// Formatted times when directories were last visited, keyed by path, and
+	// the width of their column, which is 0 if no time is shown.
+	times     map[string]string
+	timeWidth int
+	// Times when directories were last visited, keyed by path; nil if not
+	// known.
+	visitTimes map[string]time.Time
+	// If not nil, returns the spans of the shown path to highlight, as sorted
+	// and non-overlapping pairs of byte indices.
+	highlight func(path string) [][]int
+	// Whether the directories are ordered by path instead of score.
+	byPath bool
+	// Indices of group headers in dirs when grouping by parent or splitting
+	// frequent and recent directories; nil otherwise.
+	headers map[int]bool
+	// Whether the headers are section labels from splitting frequent and
+	// recent directories, instead of parent directories.
+	sections bool
+	// Whether the filter has left no directories, in which case a note is
+	// shown.
+	noMatches bool
+}
+
+// Returns the path of the directory at index i, or false if there isn't one.
+func (l list) pathAt(i int) (string, bool) {
+	if i < 0 || i >= len(l.dirs) || l.headers[i] {
+		return "", false
+	}
+	return l.dirs[i].Path, true
+}
+
+// Like the indexOfPath function, but skips group headers.
+func (l list) indexOfPath(path string) int {
+	for i, dir := range l.dirs {
+		if dir.Path == path && !l.headers[i] {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns l with the directories grouped by their parents, with a header
+// inserted before each group.
+func (l list) groupByParent() list {
+	var parents []string
+	groups := map[string][]store.Dir{}
+	for _, dir := range l.dirs {
+		parent := filepath.Dir(dir.Path)
+		if _, ok := groups[parent]; !ok {
+			parents = append(parents, parent)
+		}
+		groups[parent] = append(groups[parent], dir)
+	}
+	dirs := make([]store.Dir, 0, len(l.dirs)+len(parents))
+	headers := make(map[int]bool, len(parents))
+	for _, parent := range parents {
+		headers[len(dirs)] = true
+		dirs = append(dirs, store.Dir{Path: parent})
+		dirs = append(dirs, groups[parent]...)
+	}
+	l.dirs, l.headers = dirs, headers
+	return l
+}
+
+// Returns l with the directories split into a frequent section and a recent
+// section, as described in Config.SplitFrequentRecent, with a header inserted
+// before each non-empty section. Directories visited within recentWindow
+// before now are recent.
+func (l list) splitFrequentRecent(now time.Time) list {
+	var frequent, recent []store.Dir
+	for _, dir := range l.dirs {
+		if t, ok := l.visitTimes[dir.Path]; ok && !math.IsInf(dir.Score, 0) &&
+			now.Sub(t) < recentWindow {
+			recent = append(recent, dir)
+		} else {
+			frequent = append(frequent, dir)
+		}
+	}
+	sort.SliceStable(recent, func(i, j int) bool {
+		return l.visitTimes[recent[i].Path].After(l.visitTimes[recent[j].Path])
+	})
+	dirs := make([]store.Dir, 0, len(l.dirs)+2)
+	headers := map[int]bool{}
+	for _, section := range []struct {
+		label string
+		dirs  []store.Dir
+	}{{"frequent", frequent}, {"recent", recent}} {
+		if len(section.dirs) == 0 {
+			continue
+		}
+		headers[len(dirs)] = true
+		dirs = append(dirs, store.Dir{Path: section.label})
+		dirs = append(dirs, section.dirs...)
+	}
+	l.dirs, l.headers, l.sections = dirs, headers, true
+	return l
 }
 
-func (l list) filter(p string) list {
+func (l list) filter(p string, match func(query, path string) bool) list {
 	if p == "" {
 		return l
 	}
-	re := makeRegexpForPattern(p)
+	if match == nil {
+		re := makeRegexpForPattern(p)
+		match = func(_, path string) bool { return re.MatchString(path) }
+		l.highlight = l.baseSpans(substringSpans(p))
+	}
 	var filteredDirs []store.Dir
 	for _, dir := range l.dirs {
-		if re.MatchString(fsutil.TildeAbbr(dir.Path)) {
+		if match(p, l.matchedPath(dir.Path)) {
 			filteredDirs = append(filteredDirs, dir)
 		}
 	}
-	return list{filteredDirs}
+	l.dirs = filteredDirs
+	return l
+}
+
+// Filters l with the query p as configured by Config.Regex, Config.Filter and
+// Config.IgnoreCase.
+func (l list) filterQuery(p string, cfg Config) list {
+	if cfg.Regex {
+		if cfg.IgnoreCase && p != "" {
+			p = "(?i)" + p
+		}
+		return l.filterRegexp(p)
+	}
+	match := cfg.Filter
+	if match != nil && cfg.IgnoreCase {
+		match = func(query, path string) bool {
+			return cfg.Filter(strings.ToLower(query), strings.ToLower(path))
+		}
+	}
+	return l.filter(p, match)
+}
+
+// Returns l without the directories in paths, except pinned directories and
+// the working directory.
+func (l list) without(paths map[string]bool) list {
+	if len(paths) == 0 {
+		return l
+	}
+	var dirs []store.Dir
+	for _, dir := range l.dirs {
+		if !paths[dir.Path] || math.IsInf(dir.Score, 0) {
+			dirs = append(dirs, dir)
+		}
+	}
+	l.dirs = dirs
+	return l
+}
+
+// Like filter, but interprets p as a regular expression. If p is not a valid
+// regular expression, l is returned as is.
+func (l list) filterRegexp(p string) list {
+	if p == "" {
+		return l
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return l
+	}
+	var filteredDirs []store.Dir
+	for _, dir := range l.dirs {
+		if re.MatchString(l.matchedPath(dir.Path)) {
+			filteredDirs = append(filteredDirs, dir)
+		}
+	}
+	l.dirs = filteredDirs
+	l.highlight = l.baseSpans(func(path string) [][]int {
+		if span := re.FindStringIndex(path); span != nil && span[0] < span[1] {
+			return [][]int{span}
+		}
+		return nil
+	})
+	return l
+}
+
+// Returns the part of the shown form of path that is matched against the
+// filter.
+func (l list) matchedPath(path string) string {
+	shown := l.showPath(path)
+	if l.matchBase {
+		return filepath.Base(shown)
+	}
+	return shown
+}
+
+// If only base names are matched against the filter, returns a function that
+// applies spans to the base name of a path, with the result adjusted to be
+// indices into the full path. Otherwise returns spans as is.
+func (l list) baseSpans(spans func(path string) [][]int) func(path string) [][]int {
+	if !l.matchBase {
+		return spans
+	}
+	return func(path string) [][]int {
+		base := filepath.Base(path)
+		offset := len(path) - len(base)
+		if offset < 0 || path[offset:] != base {
+			// Can happen with trailing separators; highlight nothing.
+			return nil
+		}
+		result := spans(base)
+		for i := range result {
+			result[i] = []int{result[i][0] + offset, result[i][1] + offset}
+		}
+		return result
+	}
+}
+
+// Returns l with the directories sorted by the shown paths. The directories of l
+// itself are not modified.
+func (l list) sortByPath() list {
+	dirs := append([]store.Dir(nil), l.dirs...)
+	sort.SliceStable(dirs, func(i, j int) bool {
+		return l.showPath(dirs[i].Path) < l.showPath(dirs[j].Path)
+	})
+	l.dirs = dirs
+	return l
+}
+
+// Returns l with the directories re-ranked by their scores weighted by how well
+// their base names match the last segment of p, as described in
+// Config.SmartRank. Directories with special scores stay first.
+func (l list) smartRank(p string) list {
+	var seg string
+	for _, s := range strings.Split(p, string(os.PathSeparator)) {
+		if s != "" {
+			seg = strings.ToLower(s)
+		}
+	}
+	if seg == "" {
+		return l
+	}
+	weight := func(dir store.Dir) float64 {
+		base := strings.ToLower(filepath.Base(l.showPath(dir.Path)))
+		switch {
+		case strings.HasPrefix(base, seg):
+			return 4
+		case strings.Contains(base, seg):
+			return 2
+		default:
+			return 1
+		}
+	}
+	var special, ranked []store.Dir
+	for _, dir := range l.dirs {
+		if math.IsInf(dir.Score, 0) {
+			special = append(special, dir)
+		} else {
+			ranked = append(ranked, dir)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Score*weight(ranked[i]) > ranked[j].Score*weight(ranked[j])
+	})
+	l.dirs = append(special, ranked...)
+	return l
+}
+
+// Returns a function that finds all the occurrences of the segments of p,
+// separated by the path separator, ignoring case. Overlapping and adjacent
+// occurrences are merged.
+func substringSpans(p string) func(path string) [][]int {
+	var res []*regexp.Regexp
+	for _, seg := range strings.Split(p, string(os.PathSeparator)) {
+		if seg != "" {
+			res = append(res, regexp.MustCompile("(?i)"+regexp.QuoteMeta(seg)))
+		}
+	}
+	return func(path string) [][]int {
+		var spans [][]int
+		for _, re := range res {
+			// FindAllStringIndex doesn't find overlapping occurrences, so
+			// search from each byte after the start of the last occurrence.
+			for from := 0; from < len(path); {
+				span := re.FindStringIndex(path[from:])
+				if span == nil {
+					break
+				}
+				spans = append(spans, []int{from + span[0], from + span[1]})
+				from += span[0] + 1
+			}
+		}
+		sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+		var merged [][]int
+		for _, span := range spans {
+			if n := len(merged); n > 0 && span[0] <= merged[n-1][1] {
+				if span[1] > merged[n-1][1] {
+					merged[n-1][1] = span[1]
+				}
+				continue
+			}
+			merged = append(merged, span)
+		}
+		return merged
+	}
+}
+
+func (l list) truncate(n int) list {
+	if n <= 0 || len(l.dirs) <= n {
+		return l
+	}
+	l.dirs, l.more = l.dirs[:n], len(l.dirs)-n
+	return l
 }
 
 var (
@@ -186,16 +1213,214 @@ func makeRegexpForPattern(p string) *regexp.Regexp {
 	return re
 }
 
-func (l list) Show(i int) ui.Text {
-	return ui.T(fmt.Sprintf("%s %s",
-		showScore(l.dirs[i].Score), fsutil.TildeAbbr(l.dirs[i].Path)))
+func (l list) Show(i int) ui.Text { return l.ShowWidth(i, -1) }
+
+// ShowWidth is like Show, but shortens the path to fit in the given width by
+// eliding path components in the middle. A negative width means unlimited
+// width.
+func (l list) ShowWidth(i, width int) ui.Text {
+	if i == len(l.dirs) {
+		switch {
+		case l.loading:
+			return ui.T("loading…", ui.Dim)
+		case l.noMatches:
+			return ui.T("no matches", ui.Dim)
+		}
+		return ui.T(fmt.Sprintf("… %d more", l.more), ui.Dim)
+	}
+	if l.headers[i] {
+		if l.sections {
+			return ui.T(l.dirs[i].Path, ui.Bold)
+		}
+		return ui.T(l.showPath(l.dirs[i].Path), ui.Bold)
+	}
+	prefix := ""
+	if l.headers != nil {
+		prefix = "  "
+	}
+	if l.marked != nil {
+		if l.marked[l.dirs[i].Path] {
+			prefix += "✓ "
+		} else {
+			prefix += "  "
+		}
+	}
+	score := showScore(l.dirs[i].Score, l.scoreWidth, l.pinnedMarker)
+	head := prefix + score + " "
+	if l.timeWidth > 0 {
+		head += padLeft(l.times[l.dirs[i].Path], l.timeWidth) + " "
+	}
+	headText := ui.T(head)
+	if l.colorByScore {
+		headText = ui.Concat(ui.T(prefix),
+			ui.T(score, scoreStyling(l.dirs[i].Score, l.maxScore)),
+			ui.T(head[len(prefix)+len(score):]))
+	}
+	path := l.showPath(l.dirs[i].Path)
+	if l.headers != nil && !l.sections {
+		path = filepath.Base(path)
+	}
+	if l.maxPathLen > 0 && wcwidth.Of(path) > l.maxPathLen {
+		path = elidePath(path, l.maxPathLen)
+		path = elideMiddle(path, l.maxPathLen)
+	}
+	if width >= 0 {
+		path = elidePath(path, width-wcwidth.Of(head))
+	}
+	if l.highlight == nil {
+		if l.colorByScore {
+			return ui.Concat(headText, ui.T(path))
+		}
+		return ui.T(head + path)
+	}
+	t := headText
+	last := 0
+	for _, span := range l.highlight(path) {
+		t = ui.Concat(t, ui.T(path[last:span[0]]), ui.T(path[span[0]:span[1]], ui.Underlined))
+		last = span[1]
+	}
+	return ui.Concat(t, ui.T(path[last:]))
+}
+
+// Shortens path to fit in width by replacing path components in the middle with
+// "…", keeping the first component and as many trailing components as possible.
+// The result may still be wider than width; in that case it gets cropped when
+// rendered.
+func elidePath(path string, width int) string {
+	if wcwidth.Of(path) <= width {
+		return path
+	}
+	sep := string(os.PathSeparator)
+	parts := strings.Split(path, sep)
+	first := 0
+	if parts[0] == "" {
+		// Absolute path; the first component is after the leading separator.
+		first = 1
+	}
+	if len(parts)-first < 3 {
+		// No components in the middle.
+		return path
+	}
+	head := strings.Join(parts[:first+1], sep) + sep + "…" + sep
+	tail := parts[len(parts)-1]
+	for j := len(parts) - 2; j > first+1; j-- {
+		t := parts[j] + sep + tail
+		if wcwidth.Of(head+t) > width {
+			break
+		}
+		tail = t
+	}
+	return head + tail
+}
+
+// Shortens s to fit in width by replacing characters in the middle with "…".
+func elideMiddle(s string, width int) string {
+	if width < 1 || wcwidth.Of(s) <= width {
+		return s
+	}
+	head := wcwidth.Trim(s, (width-1)/2)
+	tailWidth := width - 1 - wcwidth.Of(head)
+	runes := []rune(s)
+	i, w := len(runes), 0
+	for i > 0 && w+wcwidth.OfRune(runes[i-1]) <= tailWidth {
+		i--
+		w += wcwidth.OfRune(runes[i])
+	}
+	return head + "…" + string(runes[i:])
 }
 
-func (l list) Len() int { return len(l.dirs) }
+func (l list) Len() int {
+	if l.loading || l.noMatches || l.more > 0 {
+		return len(l.dirs) + 1
+	}
+	return len(l.dirs)
+}
 
-func showScore(f float64) string {
-	if f == pinnedScore {
-		return "  *"
+// Returns the highest score of the directories, ignoring pinned directories
+// and the working directory.
+func maxFiniteScore(dirs []store.Dir) float64 {
+	max := 0.0
+	for _, dir := range dirs {
+		if !math.IsInf(dir.Score, 0) && dir.Score > max {
+			max = dir.Score
+		}
+	}
+	return max
+}
+
+// Stylings of scores used when Config.ColorByScore is true, from the lowest
+// to the highest scores.
+var scoreStylings = []ui.Styling{
+	ui.Dim,
+	ui.FgGreen,
+	ui.Stylings(ui.Bold, ui.FgBrightGreen),
+}
+
+// Returns the styling of a score relative to the highest score max. Pinned
+// directories and the working directory are not styled.
+func scoreStyling(f, max float64) ui.Styling {
+	if math.IsInf(f, 0) {
+		return nil
+	}
+	level := 0
+	if max > 0 {
+		level = int(f / max * float64(len(scoreStylings)))
+		if level >= len(scoreStylings) {
+			level = len(scoreStylings) - 1
+		}
+	}
+	return scoreStylings[level]
+}
+
+// Shows the score right-aligned in a column of the given display width, using
+// pinnedMarker for pinned directories.
+func showScore(f float64, width int, pinnedMarker string) string {
+	var s string
+	switch f {
+	case pinnedScore:
+		s = pinnedMarker
+	case cwdScore:
+		s = "cwd"
+	default:
+		s = fmt.Sprintf("%.0f", f)
+	}
+	return padLeft(s, width)
+}
+
+// Pads s with spaces on the left to the given display width.
+func padLeft(s string, width int) string {
+	if pad := width - wcwidth.Of(s); pad > 0 {
+		return strings.Repeat(" ", pad) + s
+	}
+	return s
+}
+
+// Formats t relative to now, like "5m ago" or "2d ago".
+func formatRelativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return "now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", d/time.Minute)
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", d/time.Hour)
+	default:
+		return fmt.Sprintf("%dd ago", d/(24*time.Hour))
+	}
+}
+
+// Width of the column of scores when Config.ScoreWidth is zero.
+const defaultScoreWidth = 3
+
+// Returns the minimal width of the column of scores that fits the scores of
+// all the directories.
+func maxScoreWidth(dirs []store.Dir, pinnedMarker string) int {
+	width := 1
+	for _, dir := range dirs {
+		if w := wcwidth.Of(showScore(dir.Score, 0, pinnedMarker)); w > width {
+			width = w
+		}
 	}
-	return fmt.Sprintf("%3.0f", f)
+	return width
 }
@@ -1,19 +1,25 @@
 package location
 
 import (
+	"context"
 	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/elves/elvish/pkg/cli"
 	. "github.com/elves/elvish/pkg/cli/clitest"
 	"github.com/elves/elvish/pkg/cli/term"
 	"github.com/elves/elvish/pkg/store"
 	"github.com/elves/elvish/pkg/testutil"
+	"github.com/elves/elvish/pkg/tt"
 	"github.com/elves/elvish/pkg/ui"
+	"github.com/elves/elvish/pkg/wcwidth"
 )
 
 type testStore struct {
@@ -21,9 +27,14 @@ type testStore struct {
 	dirsError  error
 	chdir      func(dir string) error
 	wd         string
+	// If not nil, Dirs blocks until it is closed.
+	block chan struct{}
 }
 
 func (ts testStore) Dirs(blacklist map[string]struct{}) ([]store.Dir, error) {
+	if ts.block != nil {
+		<-ts.block
+	}
 	dirs := []store.Dir{}
 	for _, dir := range ts.storedDirs {
 		if _, ok := blacklist[dir.Path]; ok {
@@ -54,6 +65,15 @@ func TestStart_NoStore(t *testing.T) {
 	f.TestTTYNotes(t, "no dir history store")
 }
 
+func TestStart_NoStore_CustomMessage(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	Start(f.App, Config{NoStoreMessage: "pas d'historique"})
+
+	f.TestTTYNotes(t, "pas d'historique")
+}
+
 func TestStart_StoreError(t *testing.T) {
 	f := Setup()
 	defer f.Stop()
@@ -63,6 +83,173 @@ func TestStart_StoreError(t *testing.T) {
 	f.TestTTYNotes(t, "db error: ERROR")
 }
 
+func TestStart_StoreError_CustomPrefix(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	Start(f.App, Config{
+		Store:       testStore{dirsError: errors.New("ERROR")},
+		ErrorPrefix: "erreur : ",
+	})
+
+	f.TestTTYNotes(t, "erreur : ERROR")
+}
+
+func TestStart_PanickingCallback(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	Start(f.App, Config{
+		Store:         testStore{},
+		IteratePinned: func(func(string)) { panic("boom") },
+	})
+
+	f.TestTTYNotes(t, "addon error: boom")
+	if addon := f.App.CopyState().Addon; addon != nil {
+		t.Errorf("addon is %v, want nil", addon)
+	}
+	// The app is still usable.
+	f.TTY.Inject(term.K('a'))
+	f.TestTTY(t, "a", term.DotHere)
+}
+
+func TestStart_PanickingAccept(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{{Path: fix("/tmp"), Score: 50}}
+	Start(f.App, Config{
+		Store:  testStore{storedDirs: dirs},
+		Accept: func(string) error { panic("boom") },
+	})
+	f.TTY.TestBuffer(t, listingBuf("", " 50 "+fix("/tmp"), "<- selected"))
+
+	f.TTY.Inject(term.K(ui.Enter))
+	f.TestTTYNotes(t, "addon error: boom")
+	// The addon stays open and keeps handling events.
+	f.TTY.Inject(term.K('t'))
+	f.TTY.TestBuffer(t, listingBuf("t", " 50 "+fix("/")+"{t}mp", "<- selected"))
+}
+
+func TestStart_Loading(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	block := make(chan struct{})
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	Start(f.App, Config{Store: testStore{storedDirs: dirs, block: block}})
+	f.TTY.TestBuffer(t, loadingBuf(""))
+
+	// The filter can be typed while loading.
+	f.TTY.Inject(term.K('u'))
+	f.TTY.TestBuffer(t, loadingBuf("u"))
+
+	close(block)
+	f.TTY.TestBuffer(t, listingBuf("u", "200 "+fix("/")+"{u}sr"+filepath.FromSlash("/bin"), "<- selected"))
+}
+
+func TestStart_Loading_Error(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	block := make(chan struct{})
+	Start(f.App, Config{
+		Store: testStore{dirsError: errors.New("ERROR"), block: block}})
+	f.TTY.TestBuffer(t, loadingBuf(""))
+
+	close(block)
+	f.TestTTYNotes(t, "db error: ERROR")
+	if addon := f.App.CopyState().Addon; addon != nil {
+		t.Errorf("addon is %v, want nil", addon)
+	}
+}
+
+type contextStore struct {
+	testStore
+	// Closed when DirsContext sees the cancellation.
+	canceled chan struct{}
+}
+
+func (cs contextStore) DirsContext(ctx context.Context, _ map[string]struct{}) ([]store.Dir, error) {
+	<-ctx.Done()
+	close(cs.canceled)
+	return nil, ctx.Err()
+}
+
+func TestStart_Loading_Canceled(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  func(f *Fixture) Config
+	}{
+		{"closed by binding", func(f *Fixture) Config {
+			// Like the close-listing builtin of the editor.
+			return Config{Binding: cli.MapHandler{term.K('[', ui.Ctrl): func() {
+				f.App.MutateState(func(s *cli.State) { s.Addon = nil })
+			}}}
+		}},
+		{"closed by cancel key", func(*Fixture) Config {
+			return Config{CancelKeys: []ui.Key{ui.K('[', ui.Ctrl)}}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := Setup()
+			defer f.Stop()
+
+			canceled := make(chan struct{})
+			cfg := test.cfg(f)
+			cfg.Store = contextStore{testStore{}, canceled}
+			Start(f.App, cfg)
+			f.TTY.TestBuffer(t, loadingBuf(""))
+
+			// Close the addon while loading.
+			f.TTY.Inject(term.K('[', ui.Ctrl))
+			f.TestTTY(t /* nothing */)
+			select {
+			case <-canceled:
+				// OK
+			case <-time.After(testutil.ScaledMs(1000)):
+				t.Fatalf("query not canceled after closing the addon")
+			}
+			testNoUpdate(t, f)
+		})
+	}
+}
+
+func TestStart_Loading_Closed(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	block := make(chan struct{})
+	Start(f.App, Config{
+		Store: testStore{dirsError: errors.New("ERROR"), block: block}})
+	f.TTY.TestBuffer(t, loadingBuf(""))
+
+	// Close the addon while loading; the result of a store that doesn't
+	// support canceling is discarded.
+	f.App.MutateState(func(s *cli.State) { s.Addon = nil })
+	f.App.Redraw()
+	f.TestTTY(t /* nothing */)
+	close(block)
+	testNoUpdate(t, f)
+}
+
+// Verifies that the buffer is not updated and no note is shown for a while.
+func testNoUpdate(t *testing.T, f *Fixture) {
+	t.Helper()
+	n := len(f.TTY.BufferHistory())
+	time.Sleep(testutil.ScaledMs(50))
+	if got := len(f.TTY.BufferHistory()); got != n {
+		t.Errorf("buffer updated %d times after closing the addon", got-n)
+	}
+	if notes := f.TTY.LastNotesBuffer(); notes != nil {
+		t.Errorf("notes shown after closing the addon: %v", notes)
+	}
+}
+
 func TestStart_Hidden(t *testing.T) {
 	f := Setup()
 	defer f.Stop()
@@ -107,6 +294,57 @@ func TestStart_Pinned(t *testing.T) {
 	f.TTY.TestBuffer(t, wantBuf)
 }
 
+// A store that ignores the blacklist.
+type leakyStore struct{ testStore }
+
+func (ls leakyStore) Dirs(map[string]struct{}) ([]store.Dir, error) {
+	return ls.storedDirs, nil
+}
+
+func TestStart_Pinned_AlsoScored(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/usr"), Score: 100},
+	}
+	Start(f.App, Config{
+		Store: leakyStore{testStore{storedDirs: dirs}},
+		IteratePinned: func(f func(string)) {
+			f(fix("/usr"))
+			f(fix("/usr"))
+		},
+	})
+	// /usr is shown once, as pinned.
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"  * "+fix("/usr"), "<- selected",
+		"200 "+fix("/usr/bin")))
+}
+
+func TestStart_PinnedMarker(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 5},
+	}
+	Start(f.App, Config{
+		Store:         testStore{storedDirs: dirs},
+		IteratePinned: func(f func(string)) { f(fix("/home")) },
+		PinnedMarker:  "📌",
+	})
+	// The marker is two columns wide, so it is padded with one space.
+	wantBuf := listingBuf(
+		"",
+		" 📌 "+fix("/home"), "<- selected",
+		"200 "+fix("/usr/bin"),
+		"  5 "+fix("/tmp"))
+	f.TTY.TestBuffer(t, wantBuf)
+}
+
 func TestStart_HideWd(t *testing.T) {
 	f := Setup()
 	defer f.Stop()
@@ -123,6 +361,62 @@ func TestStart_HideWd(t *testing.T) {
 	f.TTY.TestBuffer(t, wantBuf)
 }
 
+func TestStart_ScoreWidth(t *testing.T) {
+	tests := []struct {
+		name  string
+		dirs  []store.Dir
+		width int
+		want  []string
+	}{
+		{
+			name: "default width",
+			dirs: []store.Dir{
+				{Path: fix("/usr"), Score: 9}, {Path: fix("/tmp"), Score: 1}},
+			want: []string{"  9 " + fix("/usr"), "  1 " + fix("/tmp")},
+		},
+		{
+			name: "default width with six-digit scores",
+			dirs: []store.Dir{
+				{Path: fix("/usr"), Score: 123456}, {Path: fix("/tmp"), Score: 7}},
+			want: []string{"123456 " + fix("/usr"), "  7 " + fix("/tmp")},
+		},
+		{
+			name: "fitting single-digit scores",
+			dirs: []store.Dir{
+				{Path: fix("/usr"), Score: 9}, {Path: fix("/tmp"), Score: 1}},
+			width: -1,
+			want:  []string{"9 " + fix("/usr"), "1 " + fix("/tmp")},
+		},
+		{
+			name: "fitting six-digit scores",
+			dirs: []store.Dir{
+				{Path: fix("/usr"), Score: 123456}, {Path: fix("/tmp"), Score: 7}},
+			width: -1,
+			want:  []string{"123456 " + fix("/usr"), "     7 " + fix("/tmp")},
+		},
+		{
+			name: "explicit width",
+			dirs: []store.Dir{
+				{Path: fix("/usr"), Score: 9}, {Path: fix("/tmp"), Score: 1}},
+			width: 4,
+			want:  []string{"   9 " + fix("/usr"), "   1 " + fix("/tmp")},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := Setup()
+			defer f.Stop()
+
+			Start(f.App, Config{
+				Store:      testStore{storedDirs: test.dirs},
+				ScoreWidth: test.width,
+			})
+			f.TTY.TestBuffer(t, listingBuf(
+				"", test.want[0], "<- selected", test.want[1]))
+		})
+	}
+}
+
 func TestStart_Workspace(t *testing.T) {
 	f := Setup()
 	defer f.Stop()
@@ -203,7 +497,7 @@ func TestStart_OK(t *testing.T) {
 
 	wantBuf = listingBuf(
 		"f"+string(os.PathSeparator)+"l",
-		" 50 "+fix("/tmp/foo/bar/lorem/ipsum"), "<- selected")
+		" 50 "+fix("/tmp/")+"{f}oo"+filepath.FromSlash("/bar/")+"{l}orem"+filepath.FromSlash("/ipsum"), "<- selected")
 	f.TTY.TestBuffer(t, wantBuf)
 
 	// Test accepting.
@@ -219,19 +513,3030 @@ func TestStart_OK(t *testing.T) {
 	}
 }
 
-func listingBuf(filter string, lines ...string) *term.Buffer {
-	b := term.NewBufferBuilder(50)
-	b.Newline() // empty code area
-	cli.WriteListing(b, " LOCATION ", filter, lines...)
-	return b.Buffer()
+func TestStart_CustomFilter(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/usr"), Score: 100},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	// A subsequence matcher that ignores path separators in the path.
+	subseq := func(query, path string) bool {
+		for _, r := range path {
+			if query == "" {
+				break
+			}
+			if r == rune(query[0]) {
+				query = query[1:]
+			}
+		}
+		return query == ""
+	}
+	Start(f.App, Config{Store: testStore{storedDirs: dirs}, Filter: subseq})
+
+	f.TTY.Inject(term.K('u'), term.K('s'), term.K('r'), term.K('b'))
+	wantBuf := listingBuf(
+		"usrb",
+		"200 "+fix("/usr/bin"), "<- selected")
+	f.TTY.TestBuffer(t, wantBuf)
 }
 
-func fix(path string) string {
-	if runtime.GOOS != "windows" {
-		return path
+func TestStart_Rank(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/usr"), Score: 100},
+		{Path: fix("/tmp"), Score: 50},
 	}
-	if path[0] == '/' {
-		path = "C:" + path
+	// Reverse the order.
+	rank := func(dirs []store.Dir) []store.Dir {
+		ranked := make([]store.Dir, len(dirs))
+		for i, dir := range dirs {
+			ranked[len(dirs)-1-i] = dir
+		}
+		return ranked
 	}
-	return strings.ReplaceAll(path, "/", "\\")
+	Start(f.App, Config{
+		Store:         testStore{storedDirs: dirs},
+		IteratePinned: func(f func(string)) { f(fix("/home")) },
+		Rank:          rank,
+	})
+	wantBuf := listingBuf(
+		"",
+		"  * "+fix("/home"), "<- selected",
+		" 50 "+fix("/tmp"),
+		"100 "+fix("/usr"),
+		"200 "+fix("/usr/bin"))
+	f.TTY.TestBuffer(t, wantBuf)
+}
+
+func TestStart_Navigate(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	chdirCh := make(chan string, 100)
+	enterCh := make(chan struct{}, 1)
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/usr"), Score: 100},
+	}
+	Start(f.App, Config{
+		Store: testStore{
+			storedDirs: dirs,
+			chdir:      func(dir string) error { chdirCh <- dir; return nil },
+		},
+		NavigationBinding: cli.MapHandler{
+			term.K(ui.Enter): func() { enterCh <- struct{}{} },
+		},
+	})
+
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"), "<- selected",
+		"100 "+fix("/usr")))
+	f.TTY.Inject(term.K(ui.Down), term.K(ui.Tab), term.K(ui.Enter))
+	// Tab should change to the selected directory...
+	wantChdir := fix("/usr")
+	if got := <-chdirCh; got != wantChdir {
+		t.Errorf("Chdir called with %s, want %s", got, wantChdir)
+	}
+	// ...and start the navigation addon, which handles the following Enter.
+	select {
+	case <-enterCh:
+	case <-time.After(testutil.ScaledMs(100)):
+		t.Errorf("Enter not handled by navigation binding")
+	}
+	select {
+	case dir := <-chdirCh:
+		t.Errorf("Chdir called again with %s", dir)
+	default:
+	}
+}
+
+func TestStart_Navigate_AcceptAndPushUndo(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	acceptCh := make(chan string, 100)
+	undoCh := make(chan string, 100)
+	enterCh := make(chan struct{}, 1)
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/usr"), Score: 100},
+	}
+	Start(f.App, Config{
+		Store: testStore{
+			storedDirs: dirs,
+			wd:         fix("/home/elf"),
+			chdir: func(dir string) error {
+				t.Errorf("Store.Chdir called with %s", dir)
+				return nil
+			},
+		},
+		Accept:   func(dir string) error { acceptCh <- dir; return nil },
+		PushUndo: func(prev string) { undoCh <- prev },
+		NavigationBinding: cli.MapHandler{
+			term.K(ui.Enter): func() { enterCh <- struct{}{} },
+		},
+	})
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"), "<- selected",
+		"100 "+fix("/usr")))
+
+	// Tab changes to the selected directory the same way Enter does.
+	f.TTY.Inject(term.K(ui.Down), term.K(ui.Tab), term.K(ui.Enter))
+	if got, want := <-acceptCh, fix("/usr"); got != want {
+		t.Errorf("Accept called with %s, want %s", got, want)
+	}
+	if got, want := <-undoCh, fix("/home/elf"); got != want {
+		t.Errorf("PushUndo called with %s, want %s", got, want)
+	}
+	select {
+	case <-enterCh:
+	case <-time.After(testutil.ScaledMs(100)):
+		t.Errorf("Enter not handled by navigation binding")
+	}
+}
+
+func TestStart_Navigate_NoNavigationBinding(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{{Path: fix("/usr"), Score: 100}}
+	Start(f.App, Config{
+		Store: testStore{storedDirs: dirs},
+		Accept: func(dir string) error {
+			t.Errorf("Accept called with %s", dir)
+			return nil
+		},
+	})
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"100 "+fix("/usr"), "<- selected"))
+
+	// Tab doesn't change the directory or start the navigation addon, so the
+	// following key still goes to the filter.
+	f.TTY.Inject(term.K(ui.Tab), term.K('u'))
+	f.TTY.TestBuffer(t, listingBuf(
+		"u",
+		"100 "+fix("/")+"{u}sr", "<- selected"))
+}
+
+func TestStart_CustomAccept(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	acceptCh := make(chan string, 100)
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/usr"), Score: 100},
+	}
+	Start(f.App, Config{
+		Store: testStore{
+			storedDirs: dirs,
+			chdir: func(dir string) error {
+				t.Errorf("Chdir called with %s", dir)
+				return nil
+			},
+		},
+		Accept: func(dir string) error {
+			acceptCh <- dir
+			return errors.New("mock accept error")
+		},
+	})
+
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"), "<- selected",
+		"100 "+fix("/usr")))
+	f.TTY.Inject(term.K(ui.Down), term.K(ui.Enter))
+	f.TestTTY(t /* nothing */)
+	f.TestTTYNotes(t, "mock accept error")
+	wantAccept := fix("/usr")
+	if got := <-acceptCh; got != wantAccept {
+		t.Errorf("Accept called with %s, want %s", got, wantAccept)
+	}
+}
+
+func TestStart_PushUndo(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	undoCh := make(chan string, 100)
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/usr"), Score: 100},
+	}
+	Start(f.App, Config{
+		Store: testStore{
+			storedDirs: dirs,
+			wd:         fix("/home/elf"),
+			chdir: func(dir string) error {
+				if dir == fix("/usr/bin") {
+					return errors.New("mock chdir error")
+				}
+				return nil
+			},
+		},
+		StayOpenOnError: true,
+		PushUndo:        func(prev string) { undoCh <- prev },
+	})
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"), "<- selected",
+		"100 "+fix("/usr")))
+
+	// A failed chdir is not reported.
+	f.TTY.Inject(term.K(ui.Enter))
+	f.TestTTYNotes(t, "mock chdir error")
+	select {
+	case prev := <-undoCh:
+		t.Errorf("PushUndo called with %q after failed chdir", prev)
+	default:
+	}
+
+	f.TTY.Inject(term.K(ui.Down), term.K(ui.Enter))
+	if got, want := <-undoCh, fix("/home/elf"); got != want {
+		t.Errorf("PushUndo called with %q, want %q", got, want)
+	}
+	f.TestTTY(t /* nothing */)
+}
+
+func TestStart_StayOpenOnError(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	chdirCh := make(chan string, 100)
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/usr"), Score: 100},
+	}
+	Start(f.App, Config{
+		Store: testStore{
+			storedDirs: dirs,
+			chdir: func(dir string) error {
+				chdirCh <- dir
+				if dir == fix("/usr/bin") {
+					return errors.New("mock chdir error")
+				}
+				return nil
+			},
+		},
+		StayOpenOnError: true,
+	})
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"), "<- selected",
+		"100 "+fix("/usr")))
+
+	f.TTY.Inject(term.K(ui.Enter))
+	if got, want := <-chdirCh, fix("/usr/bin"); got != want {
+		t.Errorf("got chdir %q, want %q", got, want)
+	}
+	f.TestTTYNotes(t, "mock chdir error")
+	// The addon is still open.
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"), "<- selected",
+		"100 "+fix("/usr")))
+
+	f.TTY.Inject(term.K(ui.Down), term.K(ui.Enter))
+	if got, want := <-chdirCh, fix("/usr"); got != want {
+		t.Errorf("got chdir %q, want %q", got, want)
+	}
+	f.TestTTY(t /* nothing */)
+}
+
+func TestStart_Regex(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 100},
+		{Path: fix("/usr"), Score: 50},
+	}
+	Start(f.App, Config{Store: testStore{storedDirs: dirs}, Regex: true})
+
+	f.TTY.Inject(term.K('s'), term.K('r'), term.K('$'))
+	b := term.NewBufferBuilder(50).Newline()
+	cli.WriteListing(b, " LOCATION ", "sr$")
+	b.Newline().Write(" 50 "+fix("/u"), ui.Inverse).
+		Write("sr", ui.Inverse, ui.Underlined).
+		Write(strings.Repeat(" ", 50-len(" 50 "+fix("/usr"))), ui.Inverse)
+	f.TTY.TestBuffer(t, b.Buffer())
+
+	// An invalid regular expression shows all directories.
+	f.TTY.Inject(term.K(ui.Backspace), term.K('('))
+	f.TTY.TestBuffer(t, listingBuf(
+		"sr(",
+		"200 "+fix("/usr/bin"), "<- selected",
+		"100 "+fix("/tmp"),
+		" 50 "+fix("/usr")))
+
+	// Typing more to make it valid again.
+	f.TTY.Inject(term.K(')'))
+	b = term.NewBufferBuilder(50).Newline()
+	cli.WriteListing(b, " LOCATION ", "sr()")
+	b.Newline().Write("200 "+fix("/u"), ui.Inverse).
+		Write("sr", ui.Inverse, ui.Underlined).
+		Write(filepath.FromSlash("/bin")+strings.Repeat(" ", 50-len("200 "+fix("/usr/bin"))), ui.Inverse)
+	b.Newline().Write(" 50 "+fix("/u")).Write("sr", ui.Underlined)
+	f.TTY.TestBuffer(t, b.Buffer())
+}
+
+func TestStart_NarrowTerminal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses UNIX paths")
+	}
+	f := Setup(WithTTY(func(tty TTYCtrl) { tty.SetSize(24, 20) }))
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: "/usr/lib/golang/bin", Score: 200},
+		{Path: "/tmp", Score: 100},
+	}
+	Start(f.App, Config{Store: testStore{storedDirs: dirs}})
+	b := term.NewBufferBuilder(20).Newline()
+	cli.WriteListing(b, " LOCATION ", "",
+		"200 /usr/…/bin", "<- selected",
+		"100 /tmp")
+	f.TTY.TestBuffer(t, b.Buffer())
+}
+
+func TestStart_ShowScrollbar(t *testing.T) {
+	f := Setup(WithTTY(func(tty TTYCtrl) { tty.SetSize(6, 50) }))
+	defer f.Stop()
+
+	dirs := make([]store.Dir, 10)
+	for i := range dirs {
+		dirs[i] = store.Dir{Path: fix("/d" + string(rune('0'+i))), Score: float64(100 - i)}
+	}
+	Start(f.App, Config{Store: testStore{storedDirs: dirs}, ShowScrollbar: true})
+	testLastLine(t, f, "1/10")
+
+	f.TTY.Inject(term.K(ui.Down), term.K(ui.Down))
+	testLastLine(t, f, "3/10")
+	f.TTY.Inject(term.K(ui.PageDown), term.K(ui.PageDown), term.K(ui.PageDown))
+	testLastLine(t, f, "10/10")
+}
+
+func TestStart_CtrlPageKeys(t *testing.T) {
+	f := Setup(WithTTY(func(tty TTYCtrl) { tty.SetSize(6, 50) }))
+	defer f.Stop()
+
+	dirs := make([]store.Dir, 10)
+	for i := range dirs {
+		dirs[i] = store.Dir{Path: fix("/d" + string(rune('0'+i))), Score: float64(100 - i)}
+	}
+	Start(f.App, Config{Store: testStore{storedDirs: dirs}, ShowScrollbar: true})
+	testLastLine(t, f, "1/10")
+
+	f.TTY.Inject(term.K('D', ui.Ctrl))
+	testLastLine(t, f, "4/10")
+	f.TTY.Inject(term.K('U', ui.Ctrl))
+	testLastLine(t, f, "1/10")
+}
+
+// Waits for the last line of the buffer to end with the given text.
+func testLastLine(t *testing.T, f *Fixture, want string) {
+	t.Helper()
+	var got string
+	deadline := time.Now().Add(testutil.ScaledMs(1000))
+	for time.Now().Before(deadline) {
+		if b := f.TTY.LastBuffer(); b != nil && len(b.Lines) > 0 {
+			got = ""
+			for _, c := range b.Lines[len(b.Lines)-1] {
+				got += c.Text
+			}
+			if strings.HasSuffix(got, want) {
+				return
+			}
+		}
+		time.Sleep(testutil.ScaledMs(1))
+	}
+	t.Errorf("got last line %q, want it to end with %q", got, want)
+}
+
+// A store whose directories can be changed while it is in use.
+type mutableStore struct {
+	testStore
+	mutex *sync.Mutex
+	dirs  *[]store.Dir
+}
+
+func (ms mutableStore) Dirs(map[string]struct{}) ([]store.Dir, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	return append([]store.Dir(nil), *ms.dirs...), nil
+}
+
+func (ms mutableStore) set(dirs []store.Dir) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	*ms.dirs = dirs
+}
+
+func TestStart_Watch(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 100},
+	}
+	st := mutableStore{mutex: &sync.Mutex{}, dirs: &dirs}
+	watch := make(chan struct{})
+	defer close(watch)
+	Start(f.App, Config{Store: st, Watch: watch})
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"), "<- selected",
+		"100 "+fix("/tmp")))
+
+	f.TTY.Inject(term.K(ui.Down))
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"),
+		"100 "+fix("/tmp"), "<- selected"))
+
+	// A new directory shows up, and the selected directory is kept.
+	st.set([]store.Dir{
+		{Path: fix("/opt"), Score: 300},
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 100},
+	})
+	watch <- struct{}{}
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"300 "+fix("/opt"),
+		"200 "+fix("/usr/bin"),
+		"100 "+fix("/tmp"), "<- selected"))
+
+	// The filter is kept too.
+	f.TTY.Inject(term.K('o'))
+	f.TTY.TestBuffer(t, listingBuf("o", "300 "+fix("/")+"{o}pt", "<- selected"))
+	st.set([]store.Dir{
+		{Path: fix("/opt"), Score: 300},
+		{Path: fix("/home/bob"), Score: 50},
+	})
+	watch <- struct{}{}
+	f.TTY.TestBuffer(t, listingBuf(
+		"o",
+		"300 "+fix("/")+"{o}pt", "<- selected",
+		" 50 "+fix("/h")+"{o}"+fix("me/b")+"{o}b"))
+}
+
+func TestStart_Watch_Reopened(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{{Path: fix("/tmp"), Score: 100}}
+	st := mutableStore{mutex: &sync.Mutex{}, dirs: &dirs}
+	watch := make(chan struct{})
+	defer close(watch)
+	cfg := Config{Store: st, Watch: watch,
+		CancelKeys: []ui.Key{ui.K('G', ui.Ctrl)}}
+	Start(f.App, cfg)
+	f.TTY.TestBuffer(t, listingBuf("", "100 "+fix("/tmp"), "<- selected"))
+	f.TTY.Inject(term.K('G', ui.Ctrl))
+	f.TestTTY(t, term.DotHere)
+
+	// The closed addon no longer receives from the channel, so the
+	// notification reaches the reopened addon.
+	Start(f.App, cfg)
+	f.TTY.TestBuffer(t, listingBuf("", "100 "+fix("/tmp"), "<- selected"))
+	st.set([]store.Dir{
+		{Path: fix("/opt"), Score: 300},
+		{Path: fix("/tmp"), Score: 100},
+	})
+	watch <- struct{}{}
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"300 "+fix("/opt"),
+		"100 "+fix("/tmp"), "<- selected"))
+}
+
+func TestStart_InitialPath(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 100},
+		{Path: fix("/opt"), Score: 50},
+	}
+	Start(f.App, Config{Store: testStore{storedDirs: dirs}, InitialPath: fix("/tmp")})
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"),
+		"100 "+fix("/tmp"), "<- selected",
+		" 50 "+fix("/opt")))
+}
+
+func TestStart_InitialPath_NotShown(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 100},
+	}
+	Start(f.App, Config{Store: testStore{storedDirs: dirs}, InitialPath: fix("/home")})
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"), "<- selected",
+		"100 "+fix("/tmp")))
+}
+
+func TestStart_Abbreviations(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	sep := string(os.PathSeparator)
+	chdirCh := make(chan string, 100)
+	dirs := []store.Dir{
+		{Path: fix("/home/elf/go/src/github.com/elves"), Score: 200},
+		{Path: fix("/home/elf/go/pkg"), Score: 150},
+		{Path: fix("/home/elf/gopher"), Score: 100},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	Start(f.App, Config{
+		Store: testStore{storedDirs: dirs,
+			chdir: func(dir string) error { chdirCh <- dir; return nil }},
+		AbsolutePaths: true,
+		Abbreviations: []Abbreviation{
+			{fix("/home/elf/go"), "$GOPATH"},
+			{fix("/home/elf/go/src/github.com"), "$GH"},
+			// Loses to the earlier prefix of the same length.
+			{fix("/home/elf/go"), "$DUP"},
+		},
+	})
+	// The longest matching prefix is used, and prefixes only match whole
+	// path components.
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 $GH"+sep+"elves", "<- selected",
+		"150 $GOPATH"+sep+"pkg",
+		"100 "+fix("/home/elf/gopher"),
+		" 50 "+fix("/tmp")))
+
+	// The abbreviated paths are matched against the filter.
+	f.TTY.Inject(term.K('$'), term.K('g'), term.K('o'))
+	f.TTY.TestBuffer(t, listingBuf("$go", "150 {$GO}PATH"+sep+"pkg", "<- selected"))
+
+	// The full path is used for accepting.
+	f.TTY.Inject(term.K(ui.Enter))
+	if got, want := <-chdirCh, fix("/home/elf/go/pkg"); got != want {
+		t.Errorf("got chdir %q, want %q", got, want)
+	}
+}
+
+func TestStart_SelectedStyle(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 100},
+	}
+	Start(f.App, Config{
+		Store:         testStore{storedDirs: dirs},
+		SelectedStyle: ui.Stylings(ui.Bold, ui.FgYellow),
+	})
+	b := term.NewBufferBuilder(50).Newline()
+	cli.WriteListing(b, " LOCATION ", "")
+	selected := "200 " + fix("/usr/bin")
+	b.Newline().Write(selected+strings.Repeat(" ", 50-wcwidth.Of(selected)), ui.Bold, ui.FgYellow)
+	b.Newline().Write("100 " + fix("/tmp"))
+	f.TTY.TestBuffer(t, b.Buffer())
+}
+
+func TestStart_MaxPathLen(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses UNIX paths")
+	}
+	f := Setup()
+	defer f.Stop()
+
+	long := "/" + strings.Repeat("a", 49) + "/" + strings.Repeat("b", 49)
+	chdirCh := make(chan string, 100)
+	dirs := []store.Dir{
+		{Path: long, Score: 200},
+		{Path: "/tmp", Score: 100},
+	}
+	Start(f.App, Config{
+		Store: testStore{storedDirs: dirs,
+			chdir: func(dir string) error { chdirCh <- dir; return nil }},
+		MaxPathLen: 20,
+	})
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 /aaaaaaaa…bbbbbbbbbb", "<- selected",
+		"100 /tmp"))
+
+	f.TTY.Inject(term.K(ui.Enter))
+	if got := <-chdirCh; got != long {
+		t.Errorf("got chdir %q, want %q", got, long)
+	}
+}
+
+func TestElideMiddle(t *testing.T) {
+	tt.Test(t, tt.Fn("elideMiddle", elideMiddle), tt.Table{
+		tt.Args("abcdefgh", 8).Rets("abcdefgh"),
+		tt.Args("abcdefgh", 5).Rets("ab…gh"),
+		tt.Args("abcdefgh", 4).Rets("a…gh"),
+		// Wide characters are not split.
+		tt.Args("你好世界你好", 6).Rets("你…好"),
+		tt.Args("abcdefgh", 0).Rets("abcdefgh"),
+	})
+}
+
+func TestElidePath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses UNIX paths")
+	}
+	tests := []struct {
+		path  string
+		width int
+		want  string
+	}{
+		{"/usr/lib/golang/bin", 19, "/usr/lib/golang/bin"},
+		{"/usr/lib/golang/bin", 17, "/usr/…/golang/bin"},
+		{"/usr/lib/golang/bin", 16, "/usr/…/bin"},
+		// Can't be shortened further.
+		{"/usr/lib/golang/bin", 5, "/usr/…/bin"},
+		// No components to elide.
+		{"/usr/bin", 5, "/usr/bin"},
+		{"~/a/b/c", 5, "~/…/c"},
+	}
+	for _, test := range tests {
+		if got := elidePath(test.path, test.width); got != test.want {
+			t.Errorf("elidePath(%q, %v) -> %q, want %q",
+				test.path, test.width, got, test.want)
+		}
+	}
+}
+
+func TestStart_InitialFilter(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	Start(f.App, Config{
+		Store:         testStore{storedDirs: dirs},
+		InitialFilter: "tm",
+	})
+	wantBuf := listingBuf(
+		"tm",
+		" 50 "+fix("/")+"{tm}p", "<- selected")
+	f.TTY.TestBuffer(t, wantBuf)
+}
+
+func TestStart_RememberFilter(t *testing.T) {
+	setLastFilter("")
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	cfg := Config{Store: testStore{storedDirs: dirs}, RememberFilter: true}
+	Start(f.App, cfg)
+	f.TTY.Inject(term.K('t'), term.K('m'))
+	f.TTY.TestBuffer(t, listingBuf("tm", " 50 "+fix("/")+"{tm}p", "<- selected"))
+
+	// Close the addon and start it again.
+	f.App.MutateState(func(s *cli.State) { s.Addon = nil })
+	f.App.Redraw()
+	f.TestTTY(t /* nothing */)
+	Start(f.App, cfg)
+	f.TTY.TestBuffer(t, listingBuf("tm", " 50 "+fix("/")+"{tm}p", "<- selected"))
+	// The dot is at the end of the filter.
+	f.TTY.Inject(term.K('p'))
+	f.TTY.TestBuffer(t, listingBuf("tmp", " 50 "+fix("/")+"{tmp}", "<- selected"))
+}
+
+func TestStart_RememberFilter_Debounced(t *testing.T) {
+	setLastFilter("")
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	cfg := Config{Store: testStore{storedDirs: dirs}, RememberFilter: true,
+		FilterDebounce: testutil.ScaledMs(10)}
+	Start(f.App, cfg)
+	f.TTY.Inject(term.K('t'), term.K('m'))
+	// The filter is remembered from the goroutine doing the debounced
+	// filtering.
+	f.TTY.TestBuffer(t, listingBuf("tm", " 50 "+fix("/")+"{tm}p", "<- selected"))
+	if got := getLastFilter(); got != "tm" {
+		t.Errorf("got last filter %q, want %q", got, "tm")
+	}
+}
+
+func TestStart_SuppressRecent(t *testing.T) {
+	recentlyAccepted.paths = nil
+	defer func() { recentlyAccepted.paths = nil }()
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/usr"), Score: 100},
+		{Path: fix("/tmp"), Score: 50},
+		{Path: fix("/home"), Score: 20},
+	}
+	cfg := Config{
+		Store:          testStore{storedDirs: dirs},
+		IteratePinned:  func(f func(string)) { f(fix("/opt")) },
+		SuppressRecent: 2,
+	}
+	accept := func(downs int) {
+		t.Helper()
+		for i := 0; i < downs; i++ {
+			f.TTY.Inject(term.K(ui.Down))
+		}
+		f.TTY.Inject(term.K(ui.Enter))
+		f.TestTTY(t /* nothing */)
+	}
+
+	Start(f.App, cfg)
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"  * "+fix("/opt"), "<- selected",
+		"200 "+fix("/usr/bin"),
+		"100 "+fix("/usr"),
+		" 50 "+fix("/tmp"),
+		" 20 "+fix("/home")))
+	accept(1)
+
+	Start(f.App, cfg)
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"  * "+fix("/opt"), "<- selected",
+		"100 "+fix("/usr"),
+		" 50 "+fix("/tmp"),
+		" 20 "+fix("/home")))
+	accept(2)
+
+	// Both accepted directories are hidden, unless they match the filter.
+	Start(f.App, cfg)
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"  * "+fix("/opt"), "<- selected",
+		"100 "+fix("/usr"),
+		" 20 "+fix("/home")))
+	f.TTY.Inject(term.K('b'), term.K('i'))
+	f.TTY.TestBuffer(t, listingBuf(
+		"bi",
+		"200 "+fix("/usr/")+"{bi}n", "<- selected"))
+	f.TTY.Inject(term.K(ui.Backspace), term.K(ui.Backspace))
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"  * "+fix("/opt"), "<- selected",
+		"100 "+fix("/usr"),
+		" 20 "+fix("/home")))
+	accept(1)
+
+	// Only the 2 most recently accepted directories are hidden; pinned
+	// directories are never hidden.
+	Start(f.App, cfg)
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"  * "+fix("/opt"), "<- selected",
+		"200 "+fix("/usr/bin"),
+		" 20 "+fix("/home")))
+	accept(0)
+
+	Start(f.App, cfg)
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"  * "+fix("/opt"), "<- selected",
+		"200 "+fix("/usr/bin"),
+		" 50 "+fix("/tmp"),
+		" 20 "+fix("/home")))
+}
+
+func TestStart_MaxEntries(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/usr"), Score: 100},
+		{Path: fix("/tmp"), Score: 50},
+		{Path: fix("/home"), Score: 20},
+	}
+	Start(f.App, Config{Store: testStore{storedDirs: dirs}, MaxEntries: 2})
+
+	b := term.NewBufferBuilder(50).Newline()
+	cli.WriteListing(b, " LOCATION ", "",
+		"200 "+fix("/usr/bin"), "<- selected",
+		"100 "+fix("/usr"))
+	b.Newline().Write("… 2 more", ui.Dim)
+	f.TTY.TestBuffer(t, b.Buffer())
+
+	// Directories beyond the limit can be reached by filtering.
+	f.TTY.Inject(term.K('h'), term.K('o'))
+	f.TTY.TestBuffer(t, listingBuf("ho", " 20 "+fix("/")+"{ho}me", "<- selected"))
+}
+
+func TestStart_ReorderPinned(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	savedCh := make(chan []string, 100)
+	dirs := []store.Dir{{Path: fix("/tmp"), Score: 50}}
+	Start(f.App, Config{
+		Store: testStore{storedDirs: dirs},
+		IteratePinned: func(f func(string)) {
+			f(fix("/a"))
+			f(fix("/b"))
+			f(fix("/c"))
+		},
+		SavePinned: func(pinned []string) error { savedCh <- pinned; return nil },
+	})
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"  * "+fix("/a"), "<- selected",
+		"  * "+fix("/b"),
+		"  * "+fix("/c"),
+		" 50 "+fix("/tmp")))
+
+	f.TTY.Inject(term.K(ui.Down), term.K(ui.Up, ui.Alt))
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"  * "+fix("/b"), "<- selected",
+		"  * "+fix("/a"),
+		"  * "+fix("/c"),
+		" 50 "+fix("/tmp")))
+	testSaved(t, savedCh, fix("/b"), fix("/a"), fix("/c"))
+
+	// The selected directory can't be moved beyond the first pinned directory.
+	f.TTY.Inject(term.K(ui.Up, ui.Alt))
+	// Or the last.
+	f.TTY.Inject(term.K(ui.Down), term.K(ui.Down), term.K(ui.Down, ui.Alt))
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"  * "+fix("/b"),
+		"  * "+fix("/a"),
+		"  * "+fix("/c"), "<- selected",
+		" 50 "+fix("/tmp")))
+	select {
+	case pinned := <-savedCh:
+		t.Errorf("SavePinned called with %v", pinned)
+	default:
+	}
+}
+
+func TestStart_ToggleOrder(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 100},
+		{Path: fix("/opt"), Score: 50},
+	}
+	Start(f.App, Config{
+		Store:         testStore{storedDirs: dirs},
+		IteratePinned: func(f func(string)) { f(fix("/var")) },
+		ToggleOrder:   true,
+	})
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"  * "+fix("/var"), "<- selected",
+		"200 "+fix("/usr/bin"),
+		"100 "+fix("/tmp"),
+		" 50 "+fix("/opt")))
+
+	// The selected directory stays selected.
+	f.TTY.Inject(term.K(ui.Down), term.K('S', ui.Alt))
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		" 50 "+fix("/opt"),
+		"100 "+fix("/tmp"),
+		"200 "+fix("/usr/bin"), "<- selected",
+		"  * "+fix("/var")))
+
+	// Filtering keeps the order.
+	f.TTY.Inject(term.K('t'))
+	f.TTY.TestBuffer(t, listingBuf(
+		"t",
+		" 50 "+fix("/op")+"{t}", "<- selected",
+		"100 "+fix("/")+"{t}mp"))
+
+	f.TTY.Inject(term.K(ui.Backspace), term.K('S', ui.Alt))
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"  * "+fix("/var"),
+		"200 "+fix("/usr/bin"),
+		"100 "+fix("/tmp"),
+		" 50 "+fix("/opt"), "<- selected"))
+}
+
+func TestStart_ToggleOrder_Off(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp/bin"), Score: 100},
+	}
+	Start(f.App, Config{Store: testStore{storedDirs: dirs}})
+	// Alt-S doesn't change the order.
+	f.TTY.Inject(term.K('S', ui.Alt), term.K('b'))
+	f.TTY.TestBuffer(t, listingBuf(
+		"b",
+		"200 "+fix("/usr/")+"{b}in", "<- selected",
+		"100 "+fix("/tmp/")+"{b}in"))
+}
+
+func TestStart_ReorderPinned_NoSavePinned(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	Start(f.App, Config{
+		Store:         testStore{},
+		IteratePinned: func(f func(string)) { f(fix("/a")); f(fix("/b")) },
+	})
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"  * "+fix("/a"), "<- selected",
+		"  * "+fix("/b")))
+
+	f.TTY.Inject(term.K(ui.Down), term.K(ui.Up, ui.Alt))
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"  * "+fix("/a"),
+		"  * "+fix("/b"), "<- selected"))
+}
+
+func testSaved(t *testing.T, savedCh <-chan []string, want ...string) {
+	t.Helper()
+	select {
+	case pinned := <-savedCh:
+		if !reflect.DeepEqual(pinned, want) {
+			t.Errorf("SavePinned called with %v, want %v", pinned, want)
+		}
+	case <-time.After(testutil.ScaledMs(100)):
+		t.Errorf("SavePinned not called")
+	}
+}
+
+func TestStart_AbsolutePaths(t *testing.T) {
+	home, cleanupHome := testutil.InTempHome()
+	defer cleanupHome()
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: filepath.Join(home, "go"), Score: 200},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	Start(f.App, Config{Store: testStore{storedDirs: dirs}, AbsolutePaths: true})
+
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+filepath.Join(home, "go"), "<- selected",
+		" 50 "+fix("/tmp")))
+}
+
+func TestStart_DeleteEntry(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	var deleted []string
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/usr"), Score: 100},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	Start(f.App, Config{
+		Store: testStore{storedDirs: dirs},
+		DeleteEntry: func(path string) error {
+			if path == fix("/tmp") {
+				return errors.New("mock delete error")
+			}
+			deleted = append(deleted, path)
+			return nil
+		},
+	})
+
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"), "<- selected",
+		"100 "+fix("/usr"),
+		" 50 "+fix("/tmp")))
+	f.TTY.Inject(term.K(ui.Down), term.K(ui.Backspace, ui.Alt))
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"),
+		" 50 "+fix("/tmp"), "<- selected"))
+
+	f.TTY.Inject(term.K(ui.Backspace, ui.Alt))
+	f.TestTTYNotes(t, "mock delete error")
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"),
+		" 50 "+fix("/tmp"), "<- selected"))
+
+	if want := []string{fix("/usr")}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("deleted %v, want %v", deleted, want)
+	}
+}
+
+func TestStart_DeleteEntry_Reloaded(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 100},
+	}
+	st := mutableStore{mutex: &sync.Mutex{}, dirs: &dirs}
+	watch := make(chan struct{})
+	defer close(watch)
+	Start(f.App, Config{
+		Store: st,
+		Watch: watch,
+		DeleteEntry: func(path string) error {
+			// The directories are reloaded without the deleted directory
+			// before it is removed from the list. The second send only
+			// succeeds after the first reload is done.
+			st.set([]store.Dir{{Path: fix("/tmp"), Score: 100}})
+			watch <- struct{}{}
+			watch <- struct{}{}
+			return nil
+		},
+	})
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"), "<- selected",
+		"100 "+fix("/tmp")))
+
+	f.TTY.Inject(term.K(ui.Backspace, ui.Alt))
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"100 "+fix("/tmp"), "<- selected"))
+	time.Sleep(testutil.ScaledMs(50))
+	for _, notes := range f.TTY.NotesBufferHistory() {
+		if notes != nil {
+			t.Errorf("notes shown after deleting a reloaded directory: %v", notes)
+		}
+	}
+}
+
+func TestStart_Pin(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	var pinned []string
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/usr"), Score: 100},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	Start(f.App, Config{
+		Store:         testStore{storedDirs: dirs},
+		IteratePinned: func(f func(string)) { f(fix("/home")) },
+		Pin: func(path string) error {
+			if path == fix("/tmp") {
+				return errors.New("mock pin error")
+			}
+			pinned = append(pinned, path)
+			return nil
+		},
+	})
+
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"  * "+fix("/home"), "<- selected",
+		"200 "+fix("/usr/bin"),
+		"100 "+fix("/usr"),
+		" 50 "+fix("/tmp")))
+	f.TTY.Inject(term.K(ui.Down), term.K(ui.Down), term.K('P', ui.Alt))
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"  * "+fix("/usr"), "<- selected",
+		"  * "+fix("/home"),
+		"200 "+fix("/usr/bin"),
+		" 50 "+fix("/tmp")))
+
+	// Pinning an already pinned directory does nothing.
+	f.TTY.Inject(term.K('P', ui.Alt))
+	f.TTY.Inject(term.K(ui.Down), term.K(ui.Down), term.K(ui.Down),
+		term.K('P', ui.Alt))
+	f.TestTTYNotes(t, "mock pin error")
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"  * "+fix("/usr"),
+		"  * "+fix("/home"),
+		"200 "+fix("/usr/bin"),
+		" 50 "+fix("/tmp"), "<- selected"))
+
+	if want := []string{fix("/usr")}; !reflect.DeepEqual(pinned, want) {
+		t.Errorf("pinned %v, want %v", pinned, want)
+	}
+}
+
+func TestStart_Pin_Nil(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	Start(f.App, Config{Store: testStore{storedDirs: []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/usr"), Score: 100},
+	}}})
+	f.TTY.Inject(term.K(ui.Down), term.K('P', ui.Alt))
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"),
+		"100 "+fix("/usr"), "<- selected"))
+}
+
+func TestStart_PruneMissing(t *testing.T) {
+	tmpDir, cleanup := testutil.InTestDir()
+	defer cleanup()
+	testutil.MustMkdirAll("d1", "d2")
+	testutil.MustWriteFile("f", []byte{}, 0600)
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: filepath.Join(tmpDir, "d1"), Score: 200},
+		{Path: filepath.Join(tmpDir, "missing"), Score: 150},
+		{Path: filepath.Join(tmpDir, "f"), Score: 120},
+		{Path: filepath.Join(tmpDir, "d2"), Score: 100},
+	}
+	Start(f.App, Config{
+		Store:         testStore{storedDirs: dirs},
+		IteratePinned: func(f func(string)) { f(filepath.Join(tmpDir, "gone")) },
+		AbsolutePaths: true,
+		PruneMissing:  true,
+		StatTimeout:   testutil.ScaledMs(1000),
+	})
+
+	// Pinned directories are kept even if they no longer exist.
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"  * "+filepath.Join(tmpDir, "gone"), "<- selected",
+		"200 "+filepath.Join(tmpDir, "d1"),
+		"100 "+filepath.Join(tmpDir, "d2")))
+	// Pruned directories are not shown even when they match the filter.
+	f.TTY.Inject(term.K('m'), term.K('i'))
+	f.TTY.TestBuffer(t, noMatchesBuf("mi"))
+}
+
+func TestStart_IgnoreFile(t *testing.T) {
+	tmpDir, cleanup := testutil.InTestDir()
+	defer cleanup()
+	ignoreFile := filepath.Join(tmpDir, "ignore")
+	testutil.MustWriteFile(ignoreFile, []byte(
+		"# Build outputs\n"+fix("/build")+"\n\n"+fix("/var/*")+"\n"), 0600)
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/build/out"), Score: 180},
+		{Path: fix("/var/cache"), Score: 150},
+		{Path: fix("/var"), Score: 100},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	cfg := Config{
+		Store:         testStore{storedDirs: dirs},
+		IteratePinned: func(f func(string)) { f(fix("/build")) },
+		IgnoreFile:    ignoreFile,
+	}
+	f := Setup()
+	defer f.Stop()
+	Start(f.App, cfg)
+	// Pinned directories are not ignored.
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"  * "+fix("/build"), "<- selected",
+		"200 "+fix("/usr/bin"),
+		"100 "+fix("/var"),
+		" 50 "+fix("/tmp")))
+
+	// The file is read again when the addon is started again.
+	testutil.MustWriteFile(ignoreFile, []byte(fix("/tmp")+"\n"), 0600)
+	Start(f.App, cfg)
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"  * "+fix("/build"), "<- selected",
+		"200 "+fix("/usr/bin"),
+		"180 "+fix("/build/out"),
+		"150 "+fix("/var/cache"),
+		"100 "+fix("/var")))
+}
+
+func TestRankings_IgnoreFile_Missing(t *testing.T) {
+	tmpDir, cleanup := testutil.InTestDir()
+	defer cleanup()
+
+	dirs := []store.Dir{{Path: fix("/tmp"), Score: 50}}
+	got, err := Rankings(Config{
+		Store:      testStore{storedDirs: dirs},
+		IgnoreFile: filepath.Join(tmpDir, "missing"),
+	})
+	if !reflect.DeepEqual(got, dirs) || err != nil {
+		t.Errorf("Rankings -> %v, %v, want %v, nil", got, err, dirs)
+	}
+}
+
+func TestStart_Confirm(t *testing.T) {
+	tmpDir, cleanup := testutil.InTestDir()
+	defer cleanup()
+	testutil.MustMkdirAll("real")
+	if err := os.Symlink("real", "link"); err != nil {
+		t.Skip("symlink:", err)
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(tmpDir, "real"))
+	if err != nil {
+		panic(err)
+	}
+	f := Setup()
+	defer f.Stop()
+
+	chdirCh := make(chan string, 100)
+	link := filepath.Join(tmpDir, "link")
+	Start(f.App, Config{
+		Store: testStore{
+			storedDirs: []store.Dir{{Path: link, Score: 100}},
+			chdir:      func(dir string) error { chdirCh <- dir; return nil }},
+		AbsolutePaths: true,
+		Confirm:       true,
+	})
+	f.TTY.TestBuffer(t, listingBuf("", "100 "+link, "<- selected"))
+
+	// The first Enter shows the resolved path.
+	f.TTY.Inject(term.K(ui.Enter))
+	f.TTY.TestBuffer(t, modeLineBuf(" LOCATION "+resolved+" ", "",
+		"100 "+link, "<- selected"))
+
+	// Escape cancels the confirmation without closing the addon.
+	f.TTY.Inject(term.K('[', ui.Ctrl))
+	f.TTY.TestBuffer(t, listingBuf("", "100 "+link, "<- selected"))
+
+	// Two Enters accept the directory.
+	f.TTY.Inject(term.K(ui.Enter), term.K(ui.Enter))
+	if got := <-chdirCh; got != link {
+		t.Errorf("got chdir %q, want %q", got, link)
+	}
+	select {
+	case dir := <-chdirCh:
+		t.Errorf("unexpected chdir %q", dir)
+	default:
+	}
+}
+
+func TestStart_OpenInEditor(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	openedCh := make(chan string, 100)
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	Start(f.App, Config{
+		Store: testStore{storedDirs: dirs},
+		OpenInEditor: func(path string) error {
+			openedCh <- path
+			return errors.New("editor failed")
+		},
+	})
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"), "<- selected",
+		" 50 "+fix("/tmp")))
+
+	f.TTY.Inject(term.K(ui.Down), term.K('E', ui.Alt))
+	if got, want := <-openedCh, fix("/tmp"); got != want {
+		t.Errorf("OpenInEditor called with %q, want %q", got, want)
+	}
+	f.TestTTYNotes(t, "editor failed")
+	f.TestTTY(t /* nothing */)
+}
+
+func TestStart_OpenInEditor_Nil(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{{Path: fix("/tmp"), Score: 50}}
+	Start(f.App, Config{Store: testStore{storedDirs: dirs}})
+	f.TTY.TestBuffer(t, listingBuf("", " 50 "+fix("/tmp"), "<- selected"))
+
+	f.TTY.Inject(term.K('E', ui.Alt), term.K('t'))
+	f.TTY.TestBuffer(t, listingBuf("t", " 50 "+fix("/")+"{t}mp", "<- selected"))
+}
+
+func TestStart_AcceptWith(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	calledCh := make(chan string, 100)
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	Start(f.App, Config{
+		Store: testStore{storedDirs: dirs},
+		AcceptWith: map[ui.Key]func(string) error{
+			ui.K('G', ui.Alt): func(path string) error {
+				calledCh <- "git " + path
+				return errors.New("not a git repository")
+			},
+		},
+	})
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"), "<- selected",
+		" 50 "+fix("/tmp")))
+
+	f.TTY.Inject(term.K(ui.Down), term.K('G', ui.Alt))
+	if got, want := <-calledCh, "git "+fix("/tmp"); got != want {
+		t.Errorf("got call %q, want %q", got, want)
+	}
+	f.TestTTYNotes(t, "not a git repository")
+	f.TestTTY(t /* nothing */)
+
+	Start(f.App, Config{
+		Store: testStore{storedDirs: dirs},
+		AcceptWith: map[ui.Key]func(string) error{
+			ui.K('L', ui.Alt): func(path string) error {
+				calledCh <- "ls " + path
+				return nil
+			},
+		},
+	})
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"), "<- selected",
+		" 50 "+fix("/tmp")))
+	f.TTY.Inject(term.K('L', ui.Alt))
+	if got, want := <-calledCh, "ls "+fix("/usr/bin"); got != want {
+		t.Errorf("got call %q, want %q", got, want)
+	}
+	f.TestTTY(t /* nothing */)
+}
+
+func TestStart_CancelKeys(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	chdirCalled := false
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	f.App.CodeArea().MutateState(func(s *cli.CodeAreaState) {
+		s.Buffer = cli.CodeBuffer{Content: "echo", Dot: 4}
+	})
+	Start(f.App, Config{
+		Store: testStore{storedDirs: dirs, chdir: func(string) error {
+			chdirCalled = true
+			return nil
+		}},
+		CancelKeys: []ui.Key{ui.K('G', ui.Ctrl), ui.K('C', ui.Ctrl)},
+	})
+	f.TTY.TestPlainBuffer(t, "echo\n LOCATION\n"+
+		"200 "+fix("/usr/bin")+"\n 50 "+fix("/tmp"))
+
+	f.TTY.Inject(term.K(ui.Down), term.K('G', ui.Ctrl))
+	f.TestTTY(t, "echo", term.DotHere)
+	if chdirCalled {
+		t.Errorf("Chdir called after cancelling")
+	}
+	if addon := f.App.CopyState().Addon; addon != nil {
+		t.Errorf("addon is %v after cancelling, want nil", addon)
+	}
+}
+
+func TestStart_CopyPath(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	copiedCh := make(chan string, 100)
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	Start(f.App, Config{
+		Store: testStore{storedDirs: dirs},
+		CopyPath: func(path string) error {
+			copiedCh <- path
+			if path == fix("/tmp") {
+				return errors.New("clipboard unavailable")
+			}
+			return nil
+		},
+	})
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"), "<- selected",
+		" 50 "+fix("/tmp")))
+
+	f.TTY.Inject(term.K('C', ui.Alt))
+	if got, want := <-copiedCh, fix("/usr/bin"); got != want {
+		t.Errorf("CopyPath called with %q, want %q", got, want)
+	}
+	// The addon stays open.
+	f.TTY.Inject(term.K(ui.Down))
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"),
+		" 50 "+fix("/tmp"), "<- selected"))
+
+	// Errors are shown as notes.
+	f.TTY.Inject(term.K('C', ui.Alt))
+	if got, want := <-copiedCh, fix("/tmp"); got != want {
+		t.Errorf("CopyPath called with %q, want %q", got, want)
+	}
+	f.TestTTYNotes(t, "clipboard unavailable")
+	if addon := f.App.CopyState().Addon; addon == nil {
+		t.Errorf("addon closed after CopyPath failed")
+	}
+}
+
+func TestStart_CopyPath_Nil(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{{Path: fix("/tmp"), Score: 50}}
+	Start(f.App, Config{Store: testStore{storedDirs: dirs}})
+	f.TTY.TestBuffer(t, listingBuf("", " 50 "+fix("/tmp"), "<- selected"))
+
+	f.TTY.Inject(term.K('C', ui.Alt), term.K('t'))
+	f.TTY.TestBuffer(t, listingBuf("t", " 50 "+fix("/")+"{t}mp", "<- selected"))
+}
+
+func TestStart_GroupByParent(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 100},
+		{Path: fix("/usr/lib"), Score: 50},
+	}
+	Start(f.App, Config{
+		Store:         testStore{storedDirs: dirs},
+		AbsolutePaths: true,
+		GroupByParent: true,
+	})
+	// The first header is skipped when selecting the first entry.
+	f.TTY.TestBuffer(t, groupedBuf(
+		"",
+		fix("/usr"), header,
+		"  200 bin", cli.Selected,
+		"   50 lib",
+		fix("/"), header,
+		"  100 tmp"))
+
+	// Down skips the header.
+	f.TTY.Inject(term.K(ui.Down), term.K(ui.Down))
+	f.TTY.TestBuffer(t, groupedBuf(
+		"",
+		fix("/usr"), header,
+		"  200 bin",
+		"   50 lib",
+		fix("/"), header,
+		"  100 tmp", cli.Selected))
+
+	// So does Up.
+	f.TTY.Inject(term.K(ui.Up))
+	f.TTY.TestBuffer(t, groupedBuf(
+		"",
+		fix("/usr"), header,
+		"  200 bin",
+		"   50 lib", cli.Selected,
+		fix("/"), header,
+		"  100 tmp"))
+
+	// Up from the first entry stays on it.
+	f.TTY.Inject(term.K(ui.Up), term.K(ui.Up))
+	f.TTY.TestBuffer(t, groupedBuf(
+		"",
+		fix("/usr"), header,
+		"  200 bin", cli.Selected,
+		"   50 lib",
+		fix("/"), header,
+		"  100 tmp"))
+
+	// Filtering matches the full paths of the entries.
+	f.TTY.Inject(term.K('t'), term.K('m'))
+	f.TTY.TestBuffer(t, groupedBuf(
+		"tm",
+		fix("/"), header,
+		"  100 {tm}p", cli.Selected))
+}
+
+// A special value in the argument to groupedBuf, signalling that the argument
+// before it is a group header.
+const header = "<- header"
+
+func groupedBuf(filter string, lines ...string) *term.Buffer {
+	b := term.NewBufferBuilder(50).Newline()
+	cli.WriteListing(b, " LOCATION ", filter)
+	for i, line := range lines {
+		if line == header || line == cli.Selected {
+			continue
+		}
+		b.Newline()
+		if i < len(lines)-1 && lines[i+1] == header {
+			b.Write(line, ui.Bold)
+		} else {
+			writeLine(b, line, i < len(lines)-1 && lines[i+1] == cli.Selected)
+		}
+	}
+	return b.Buffer()
+}
+
+func TestStart_FilterDebounce(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	type call struct {
+		f       func()
+		stopped bool
+	}
+	var callsMutex sync.Mutex
+	var calls []*call
+	savedAfterFunc := afterFunc
+	defer func() { afterFunc = savedAfterFunc }()
+	afterFunc = func(_ time.Duration, f func()) func() bool {
+		callsMutex.Lock()
+		defer callsMutex.Unlock()
+		c := &call{f: f}
+		calls = append(calls, c)
+		return func() bool {
+			callsMutex.Lock()
+			defer callsMutex.Unlock()
+			c.stopped = true
+			return true
+		}
+	}
+
+	queriesCh := make(chan string, 100)
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	Start(f.App, Config{
+		Store: testStore{storedDirs: dirs},
+		Filter: func(query, path string) bool {
+			queriesCh <- query
+			return strings.Contains(path, query)
+		},
+		FilterDebounce: time.Second,
+	})
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"), "<- selected",
+		" 50 "+fix("/tmp")))
+
+	// The query is shown immediately, but the directories are not filtered
+	// yet.
+	f.TTY.Inject(term.K('t'), term.K('m'), term.K('p'))
+	f.TTY.TestBuffer(t, listingBuf(
+		"tmp",
+		"200 "+fix("/usr/bin"), "<- selected",
+		" 50 "+fix("/tmp")))
+
+	callsMutex.Lock()
+	var pending []*call
+	for _, c := range calls {
+		if !c.stopped {
+			pending = append(pending, c)
+		}
+	}
+	callsMutex.Unlock()
+	if len(calls) != 3 || len(pending) != 1 {
+		t.Fatalf("got %d scheduled and %d pending filterings, want 3 and 1",
+			len(calls), len(pending))
+	}
+	pending[0].f()
+	f.TTY.TestBuffer(t, listingBuf("tmp", " 50 "+fix("/tmp"), "<- selected"))
+
+	// Filtering only ran once, with the full query.
+	close(queriesCh)
+	for query := range queriesCh {
+		if query != "tmp" {
+			t.Errorf("filtered with %q, want only \"tmp\"", query)
+		}
+	}
+}
+
+func TestStart_HighlightMatches(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/home/us/Museum"), Score: 100},
+	}
+	Start(f.App, Config{Store: testStore{storedDirs: dirs}})
+
+	// All occurrences are highlighted, in every row, ignoring case.
+	f.TTY.Inject(term.K('u'), term.K('s'))
+	f.TTY.TestBuffer(t, listingBuf(
+		"us",
+		"200 "+fix("/")+"{us}r"+filepath.FromSlash("/bin"), "<- selected",
+		"100 "+fix("/home/")+"{us}"+filepath.FromSlash("/M")+"{us}eum"))
+}
+
+func TestStart_MatchBasenameOnly(t *testing.T) {
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin/x"), Score: 200},
+		{Path: fix("/opt/bin"), Score: 100},
+	}
+
+	t.Run("default matcher", func(t *testing.T) {
+		f := Setup()
+		defer f.Stop()
+		Start(f.App, Config{Store: testStore{storedDirs: dirs}, MatchBasenameOnly: true})
+		// The query matches a middle segment of /usr/bin/x, which is excluded.
+		f.TTY.Inject(term.K('b'), term.K('i'), term.K('n'))
+		f.TTY.TestBuffer(t, listingBuf("bin", "100 "+fix("/opt/")+"{bin}", "<- selected"))
+	})
+
+	t.Run("regex with IgnoreCase", func(t *testing.T) {
+		f := Setup()
+		defer f.Stop()
+		Start(f.App, Config{
+			Store:             testStore{storedDirs: dirs},
+			MatchBasenameOnly: true,
+			Regex:             true,
+			IgnoreCase:        true,
+		})
+		f.TTY.Inject(term.K('B'), term.K('I'), term.K('N'))
+		f.TTY.TestBuffer(t, listingBuf("BIN", "100 "+fix("/opt/")+"{bin}", "<- selected"))
+		// Only the base name is matched, so anchors apply to it.
+		f.TTY.Inject(term.K(ui.Backspace), term.K(ui.Backspace), term.K(ui.Backspace),
+			term.K('^'), term.K('x'))
+		f.TTY.TestBuffer(t, listingBuf("^x", "200 "+fix("/usr/bin/")+"{x}", "<- selected"))
+	})
+
+	t.Run("custom Filter", func(t *testing.T) {
+		f := Setup()
+		defer f.Stop()
+		Start(f.App, Config{
+			Store:             testStore{storedDirs: dirs},
+			MatchBasenameOnly: true,
+			Filter:            func(query, name string) bool { return name == query },
+			IgnoreCase:        true,
+		})
+		f.TTY.Inject(term.K('B'), term.K('i'), term.K('n'))
+		f.TTY.TestBuffer(t, listingBuf("Bin", "100 "+fix("/opt/bin"), "<- selected"))
+	})
+}
+
+func TestSubstringSpans(t *testing.T) {
+	sep := string(os.PathSeparator)
+	tt.Test(t, tt.Fn("substringSpans", func(p, path string) [][]int {
+		return substringSpans(p)(path)
+	}), tt.Table{
+		// Empty query.
+		tt.Args("", "/usr").Rets([][]int(nil)),
+		tt.Args("us", "/usr/us").Rets([][]int{{1, 3}, {5, 7}}),
+		tt.Args("US", "/usr").Rets([][]int{{1, 3}}),
+		// Overlapping occurrences are merged.
+		tt.Args("aa", "/aaa").Rets([][]int{{1, 4}}),
+		// So are occurrences of different segments.
+		tt.Args("ab"+sep+"bc", "abc").Rets([][]int{{0, 3}}),
+		tt.Args("x", "/usr").Rets([][]int(nil)),
+	})
+}
+
+func TestStart_Stores(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	chdirCh := make(chan string, 100)
+	personal := testStore{
+		storedDirs: []store.Dir{
+			{Path: fix("/usr/bin"), Score: 200},
+			{Path: fix("/tmp"), Score: 50},
+		},
+		chdir: func(dir string) error {
+			if dir == fix("/team") {
+				return errors.New("not in personal store")
+			}
+			chdirCh <- "personal " + dir
+			return nil
+		}}
+	team := testStore{
+		storedDirs: []store.Dir{
+			{Path: fix("/tmp"), Score: 300},
+			{Path: fix("/team"), Score: 100},
+		},
+		chdir: func(dir string) error { chdirCh <- "team " + dir; return nil }}
+	Start(f.App, Config{Store: personal, Stores: []Store{team}})
+	// Scores of the same directory are summed.
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"350 "+fix("/tmp"), "<- selected",
+		"200 "+fix("/usr/bin"),
+		"100 "+fix("/team")))
+
+	// Changing directory is done with the first store that succeeds.
+	f.TTY.Inject(term.K(ui.Down), term.K(ui.Down), term.K(ui.Enter))
+	if got, want := <-chdirCh, "team "+fix("/team"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRankings_Stores(t *testing.T) {
+	dirs1 := []store.Dir{{Path: fix("/a"), Score: 10}}
+	dirs2 := []store.Dir{{Path: fix("/b"), Score: 20}, {Path: fix("/a"), Score: 15}}
+	err := errors.New("ERROR")
+	got, gotErr := Rankings(Config{Stores: []Store{
+		testStore{storedDirs: dirs1},
+		testStore{storedDirs: dirs2, dirsError: err},
+	}})
+	want := []store.Dir{{Path: fix("/a"), Score: 25}, {Path: fix("/b"), Score: 20}}
+	if !reflect.DeepEqual(got, want) || gotErr != err {
+		t.Errorf("Rankings -> %v, %v, want %v, %v", got, gotErr, want, err)
+	}
+}
+
+func TestMultiStore_OptionalInterfaces(t *testing.T) {
+	factorCh := make(chan float64, 2)
+	bumpCh := make(chan string, 2)
+	t1 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	ms := multiStore{
+		testStore{},
+		decayStore{testStore{}, factorCh},
+		bumpStore{testStore{}, bumpCh},
+		bumpStore{testStore{}, bumpCh},
+		timeStore{times: map[string]time.Time{fix("/a"): t1, fix("/b"): t2}},
+		timeStore{times: map[string]time.Time{fix("/a"): t2}},
+	}
+
+	if err := DecayScores(ms, 0.5); err != nil {
+		t.Errorf("DecayScores -> %v, want nil", err)
+	}
+	if factor := <-factorCh; factor != 0.5 {
+		t.Errorf("store.DecayScores called with %v, want 0.5", factor)
+	}
+
+	// Only the first store that supports bumping is bumped.
+	if err := Bump(ms, fix("/tmp")); err != nil {
+		t.Errorf("Bump -> %v, want nil", err)
+	}
+	if n := len(bumpCh); n != 1 {
+		t.Errorf("%d stores bumped, want 1", n)
+	}
+
+	// The latest time of each directory is kept.
+	times, err := ms.VisitTimes()
+	wantTimes := map[string]time.Time{fix("/a"): t2, fix("/b"): t2}
+	if !reflect.DeepEqual(times, wantTimes) || err != nil {
+		t.Errorf("VisitTimes -> %v, %v, want %v, nil", times, err, wantTimes)
+	}
+
+	// Stores that implement none of the interfaces.
+	ms = multiStore{testStore{}, testStore{}}
+	if err := DecayScores(ms, 0.5); err != errNoDecay {
+		t.Errorf("DecayScores -> %v, want %v", err, errNoDecay)
+	}
+	if err := Bump(ms, fix("/tmp")); err != errNoBump {
+		t.Errorf("Bump -> %v, want %v", err, errNoBump)
+	}
+	if times, err := ms.VisitTimes(); len(times) != 0 || err != nil {
+		t.Errorf("VisitTimes -> %v, %v, want empty, nil", times, err)
+	}
+}
+
+func TestStart_ChdirTimeout(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	unblock := make(chan struct{})
+	defer close(unblock)
+	dirs := []store.Dir{{Path: fix("/mnt/net"), Score: 50}}
+	Start(f.App, Config{
+		Store: testStore{
+			storedDirs: dirs,
+			chdir:      func(string) error { <-unblock; return nil }},
+		ChdirTimeout: testutil.ScaledMs(10),
+	})
+	f.TTY.TestBuffer(t, listingBuf("", " 50 "+fix("/mnt/net"), "<- selected"))
+
+	f.TTY.Inject(term.K(ui.Enter))
+	f.TestTTYNotes(t, "chdir timed out")
+	// The addon stays open.
+	f.TTY.Inject(term.K('n'))
+	f.TTY.TestBuffer(t, listingBuf("n", " 50 "+fix("/m")+"{n}t"+string(os.PathSeparator)+"{n}et", "<- selected"))
+}
+
+func TestStart_IgnoreCase(t *testing.T) {
+	dirs := []store.Dir{
+		{Path: fix("/home/Downloads"), Score: 200},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	for _, ignoreCase := range []bool{false, true} {
+		f := Setup()
+		Start(f.App, Config{
+			Store:      testStore{storedDirs: dirs},
+			Filter:     func(query, path string) bool { return strings.Contains(path, query) },
+			IgnoreCase: ignoreCase,
+		})
+		f.TTY.Inject(term.K('d'), term.K('o'), term.K('w'), term.K('n'))
+		if ignoreCase {
+			// The path is still shown with its original case.
+			f.TTY.TestBuffer(t, listingBuf(
+				"down", "200 "+fix("/home/Downloads"), "<- selected"))
+		} else {
+			f.TTY.TestBuffer(t, noMatchesBuf("down"))
+		}
+		f.Stop()
+	}
+}
+
+func TestRankings(t *testing.T) {
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/usr"), Score: 100},
+		{Path: fix("ws/src"), Score: 80},
+		{Path: fix("other/src"), Score: 70},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	ws := func(f func(kind, pattern string) bool) {
+		if runtime.GOOS == "windows" {
+			f("ws", `C:\\home\\[^\\]+`)
+		} else {
+			f("ws", "/home/[^/]+")
+		}
+	}
+	got, err := Rankings(Config{
+		Store:             testStore{storedDirs: dirs, wd: fix("/home/elf")},
+		IteratePinned:     func(f func(string)) { f(fix("/opt")) },
+		IterateHidden:     func(f func(string)) { f(fix("/usr")) },
+		IterateWorkspaces: ws,
+	})
+	want := []store.Dir{
+		{Path: fix("/opt"), Score: pinnedScore},
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("ws/src"), Score: 80},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	if !reflect.DeepEqual(got, want) || err != nil {
+		t.Errorf("Rankings -> %v, %v, want %v, nil", got, err, want)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	cfg := Config{Store: testStore{storedDirs: []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/usr"), Score: 100},
+		{Path: fix("/tmp"), Score: 50},
+	}}}
+	tests := []struct {
+		name    string
+		cfg     Config
+		query   string
+		want    string
+		wantErr error
+	}{
+		{"empty query", cfg, "", fix("/usr/bin"), nil},
+		{"ambiguous query", cfg, "usr", fix("/usr/bin"), nil},
+		{"unique query", cfg, "tmp", fix("/tmp"), nil},
+		{"no match", cfg, "nowhere", "", errNoMatch},
+		{"no store", Config{}, "usr", "", errNoStore},
+		{"custom filter ignoring case", Config{Store: cfg.Store, IgnoreCase: true,
+			Filter: func(q, path string) bool { return strings.HasSuffix(path, q) }},
+			"TMP", fix("/tmp"), nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Select(test.cfg, test.query)
+			if got != test.want || err != test.wantErr {
+				t.Errorf("Select(%q) -> %q, %v, want %q, %v",
+					test.query, got, err, test.want, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestRankings_Blacklist(t *testing.T) {
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/private/var/a"), Score: 150},
+		{Path: fix("/usr"), Score: 100},
+		{Path: fix("/private/var"), Score: 50},
+	}
+	got, err := Rankings(Config{
+		Store:         testStore{storedDirs: dirs},
+		IteratePinned: func(f func(string)) { f(fix("/private/var/pinned")) },
+		IterateHidden: func(f func(string)) { f(fix("/usr")) },
+		Blacklist: func(path string) bool {
+			return hasPathPrefix(path, fix("/private/var"))
+		},
+		Extra: func() []store.Dir {
+			return []store.Dir{{Path: fix("/private/var/extra"), Score: 10}}
+		},
+	})
+	// Both the exact blacklist and the predicate apply; pinned directories are
+	// not affected by the predicate.
+	want := []store.Dir{
+		{Path: fix("/private/var/pinned"), Score: pinnedScore},
+		{Path: fix("/usr/bin"), Score: 200},
+	}
+	if !reflect.DeepEqual(got, want) || err != nil {
+		t.Errorf("Rankings -> %v, %v, want %v, nil", got, err, want)
+	}
+}
+
+func TestRankings_Dedup(t *testing.T) {
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 50},
+		{Path: fix("/usr/bin"), Score: 20},
+	}
+	extra := []store.Dir{
+		{Path: fix("/tmp"), Score: 300},
+		{Path: fix("/mnt/vol"), Score: 100},
+		{Path: fix("/mnt/vol"), Score: 150},
+	}
+	tests := []struct {
+		name string
+		mode Dedup
+		want []store.Dir
+	}{
+		{
+			name: "default",
+			want: []store.Dir{
+				{Path: fix("/usr/bin"), Score: 200},
+				{Path: fix("/mnt/vol"), Score: 100},
+				{Path: fix("/tmp"), Score: 50},
+			},
+		},
+		{
+			name: "keep-first",
+			mode: KeepFirst,
+			want: []store.Dir{
+				{Path: fix("/usr/bin"), Score: 200},
+				{Path: fix("/mnt/vol"), Score: 100},
+				{Path: fix("/tmp"), Score: 50},
+			},
+		},
+		{
+			name: "keep-highest-score",
+			mode: KeepHighestScore,
+			want: []store.Dir{
+				{Path: fix("/tmp"), Score: 300},
+				{Path: fix("/usr/bin"), Score: 200},
+				{Path: fix("/mnt/vol"), Score: 150},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Rankings(Config{
+				Store: testStore{storedDirs: dirs},
+				Extra: func() []store.Dir { return extra },
+				Dedup: test.mode,
+			})
+			if !reflect.DeepEqual(got, test.want) || err != nil {
+				t.Errorf("Rankings -> %v, %v, want %v, nil", got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestDedup_Stable(t *testing.T) {
+	dirs := []store.Dir{
+		{Path: "a", Score: 10},
+		{Path: "b", Score: 30},
+		{Path: "a", Score: 20},
+		{Path: "c", Score: 5},
+		{Path: "b", Score: 30},
+	}
+	// The kept directories stay at the positions of the first ones with their
+	// paths.
+	if got, want := dedup(dirs, KeepFirst), []store.Dir{
+		{Path: "a", Score: 10}, {Path: "b", Score: 30}, {Path: "c", Score: 5},
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dedup(KeepFirst) -> %v, want %v", got, want)
+	}
+	if got, want := dedup(dirs, KeepHighestScore), []store.Dir{
+		{Path: "a", Score: 20}, {Path: "b", Score: 30}, {Path: "c", Score: 5},
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dedup(KeepHighestScore) -> %v, want %v", got, want)
+	}
+}
+
+func TestRankings_Errors(t *testing.T) {
+	_, err := Rankings(Config{})
+	if err == nil {
+		t.Errorf("Rankings with no store returns no error")
+	}
+
+	errStore := errors.New("ERROR")
+	got, err := Rankings(Config{
+		Store:         testStore{dirsError: errStore},
+		IteratePinned: func(f func(string)) { f(fix("/opt")) },
+	})
+	want := []store.Dir{{Path: fix("/opt"), Score: pinnedScore}}
+	if !reflect.DeepEqual(got, want) || err != errStore {
+		t.Errorf("Rankings -> %v, %v, want %v, %v", got, err, want, errStore)
+	}
+}
+
+func TestStart_Glob(t *testing.T) {
+	home, cleanupHome := testutil.InTempHome()
+	defer cleanupHome()
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: filepath.Join(home, "projects", "a"), Score: 200},
+		{Path: filepath.Join(home, "projects"), Score: 180},
+		{Path: filepath.Join(home, "projects", "a", "src"), Score: 150},
+		{Path: filepath.Join(home, "projects", "b"), Score: 120},
+		{Path: filepath.Join(home, "go"), Score: 100},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	Start(f.App, Config{
+		Store:         testStore{storedDirs: dirs},
+		IteratePinned: func(f func(string)) { f(fix("/opt")) },
+		Glob:          filepath.Join("~", "projects", "*"),
+	})
+
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"  * "+fix("/opt"), "<- selected",
+		"200 "+filepath.Join("~", "projects", "a"),
+		"150 "+filepath.Join("~", "projects", "a", "src"),
+		"120 "+filepath.Join("~", "projects", "b")))
+
+	// The filter further narrows the list.
+	f.TTY.Inject(term.K('s'), term.K('r'))
+	f.TTY.TestBuffer(t, listingBuf(
+		"sr",
+		"150 "+filepath.Join("~", "projects", "a", "{sr}c"), "<- selected"))
+}
+
+func TestStart_MultiSelect(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	acceptCh := make(chan []string, 100)
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/usr"), Score: 100},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	Start(f.App, Config{
+		Store:       testStore{storedDirs: dirs},
+		MultiSelect: true,
+		AcceptMulti: func(paths []string) error { acceptCh <- paths; return nil },
+	})
+
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"  200 "+fix("/usr/bin"), "<- selected",
+		"  100 "+fix("/usr"),
+		"   50 "+fix("/tmp")))
+	// Mark /tmp, then /usr/bin. Marking moves the selection down.
+	f.TTY.Inject(term.K(ui.Down), term.K(ui.Down), term.K(' '),
+		term.K(ui.Up), term.K(ui.Up), term.K(' '))
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"✓ 200 "+fix("/usr/bin"),
+		"  100 "+fix("/usr"), "<- selected",
+		"✓  50 "+fix("/tmp")))
+
+	f.TTY.Inject(term.K(ui.Enter))
+	f.TestTTY(t /* nothing */)
+	// Paths are in the order they are shown.
+	if got, want := <-acceptCh, []string{fix("/usr/bin"), fix("/tmp")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("AcceptMulti called with %v, want %v", got, want)
+	}
+}
+
+func TestStart_ShowCwd(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	chdirCh := make(chan string, 100)
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	Start(f.App, Config{
+		Store: testStore{
+			storedDirs: dirs, wd: fix("/home"),
+			chdir: func(dir string) error { chdirCh <- dir; return nil }},
+		// A pinned working directory is only shown once.
+		IteratePinned: func(f func(string)) { f(fix("/home")) },
+		ShowCwd:       true,
+	})
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"cwd "+fix("/home"), "<- selected",
+		"200 "+fix("/usr/bin"),
+		" 50 "+fix("/tmp")))
+
+	f.TTY.Inject(term.K(ui.Enter))
+	if got, want := <-chdirCh, fix("/home"); got != want {
+		t.Errorf("got chdir %q, want %q", got, want)
+	}
+}
+
+func TestStart_ExcludeCwd(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/home"), Score: 100},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	Start(f.App, Config{
+		// The store returns the working directory despite the blacklist.
+		Store:         leakyStore{testStore{storedDirs: dirs, wd: fix("/home")}},
+		IteratePinned: func(f func(string)) { f(fix("/home")) },
+		ShowCwd:       true,
+		ExcludeCwd:    true,
+	})
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"), "<- selected",
+		" 50 "+fix("/tmp")))
+}
+
+func TestRankings_ExcludeCwd(t *testing.T) {
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	tests := []struct {
+		name string
+		wd   string
+		want []store.Dir
+	}{
+		{"working directory in history", fix("/tmp"), dirs[:1]},
+		{"working directory not in history is a no-op", fix("/home"), dirs},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Rankings(Config{
+				Store:      leakyStore{testStore{storedDirs: dirs, wd: test.wd}},
+				ExcludeCwd: true,
+			})
+			if !reflect.DeepEqual(got, test.want) || err != nil {
+				t.Errorf("Rankings with wd %s -> %v, %v, want %v, nil",
+					test.wd, got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestRankings_ShowCwd(t *testing.T) {
+	cfg := Config{
+		Store: testStore{storedDirs: []store.Dir{
+			{Path: fix("/usr/bin"), Score: 200},
+			{Path: fix("/tmp"), Score: 50},
+		}, wd: fix("/home")},
+		IteratePinned: func(f func(string)) { f(fix("/home")) },
+		ShowCwd:       true,
+	}
+	got, err := Rankings(cfg)
+	want := []store.Dir{
+		{Path: fix("/home"), Score: cwdScore},
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	if !reflect.DeepEqual(got, want) || err != nil {
+		t.Errorf("Rankings -> %v, %v, want %v, nil", got, err, want)
+	}
+
+	// Select agrees with what is shown: the working directory comes first.
+	if got, err := Select(cfg, ""); got != fix("/home") || err != nil {
+		t.Errorf("Select -> %q, %v, want %q, nil", got, err, fix("/home"))
+	}
+}
+
+func TestStart_ModeLine(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{{Path: fix("/tmp"), Score: 50}}
+	Start(f.App, Config{Store: testStore{storedDirs: dirs}, ModeLine: "JUMP"})
+	f.TTY.TestBuffer(t, modeLineBuf(" JUMP ", "",
+		" 50 "+fix("/tmp"), "<- selected"))
+}
+
+func TestStart_Extra(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	chdirCh := make(chan string, 100)
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	Start(f.App, Config{
+		Store: testStore{
+			storedDirs: dirs,
+			chdir:      func(dir string) error { chdirCh <- dir; return nil }},
+		IterateHidden: func(f func(string)) { f(fix("/hidden")) },
+		Extra: func() []store.Dir {
+			return []store.Dir{
+				// Not in the store; merged by score.
+				{Path: fix("/mnt/vol"), Score: 100},
+				{Path: fix("/mnt/old"), Score: 10},
+				// Already in the store; the score from the store is used.
+				{Path: fix("/tmp"), Score: 300},
+				// Hidden.
+				{Path: fix("/hidden"), Score: 150},
+			}
+		},
+	})
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"), "<- selected",
+		"100 "+fix("/mnt/vol"),
+		" 50 "+fix("/tmp"),
+		" 10 "+fix("/mnt/old")))
+
+	// Extra directories participate in filtering and can be accepted.
+	f.TTY.Inject(term.K('v'), term.K('o'), term.K('l'))
+	f.TTY.TestBuffer(t, listingBuf(
+		"vol",
+		"100 "+fix("/mnt/")+"{vol}", "<- selected"))
+	f.TTY.Inject(term.K(ui.Enter))
+	if got, want := <-chdirCh, fix("/mnt/vol"); got != want {
+		t.Errorf("got chdir %q, want %q", got, want)
+	}
+}
+
+type decayStore struct {
+	testStore
+	factorCh chan float64
+}
+
+func (ds decayStore) DecayScores(factor float64) error {
+	ds.factorCh <- factor
+	return nil
+}
+
+func TestDecayScores(t *testing.T) {
+	factorCh := make(chan float64, 1)
+	err := DecayScores(decayStore{testStore{}, factorCh}, 0.5)
+	if err != nil {
+		t.Errorf("DecayScores -> %v, want nil", err)
+	}
+	if factor := <-factorCh; factor != 0.5 {
+		t.Errorf("store.DecayScores called with %v, want 0.5", factor)
+	}
+
+	if err := DecayScores(testStore{}, 0.5); err != errNoDecay {
+		t.Errorf("DecayScores -> %v, want %v", err, errNoDecay)
+	}
+	if err := DecayScores(nil, 0.5); err != errNoStore {
+		t.Errorf("DecayScores -> %v, want %v", err, errNoStore)
+	}
+}
+
+type bumpStore struct {
+	testStore
+	bumpCh chan string
+}
+
+func (bs bumpStore) Bump(path string) error {
+	bs.bumpCh <- path
+	return nil
+}
+
+func TestBump(t *testing.T) {
+	bumpCh := make(chan string, 1)
+	err := Bump(bumpStore{testStore{}, bumpCh}, fix("/tmp"))
+	if err != nil {
+		t.Errorf("Bump -> %v, want nil", err)
+	}
+	if path := <-bumpCh; path != fix("/tmp") {
+		t.Errorf("store.Bump called with %v, want %v", path, fix("/tmp"))
+	}
+
+	if err := Bump(testStore{}, fix("/tmp")); err != errNoBump {
+		t.Errorf("Bump -> %v, want %v", err, errNoBump)
+	}
+	if err := Bump(nil, fix("/tmp")); err != errNoStore {
+		t.Errorf("Bump -> %v, want %v", err, errNoStore)
+	}
+}
+
+func listingBuf(filter string, lines ...string) *term.Buffer {
+	return modeLineBuf(" LOCATION ", filter, lines...)
+}
+
+// Like listingBuf, but with a custom mode line.
+func modeLineBuf(modeLine, filter string, lines ...string) *term.Buffer {
+	b := term.NewBufferBuilder(50)
+	b.Newline() // empty code area
+	cli.WriteListing(b, modeLine, filter)
+	for i, line := range lines {
+		if line == cli.Selected {
+			continue
+		}
+		b.Newline()
+		writeLine(b, line, i < len(lines)-1 && lines[i+1] == cli.Selected)
+	}
+	return b.Buffer()
+}
+
+// Writes a line in the listing, in which parts enclosed in braces are
+// highlighted. If selected is true, the line is padded and styled like the
+// selected line.
+func writeLine(b *term.BufferBuilder, line string, selected bool) {
+	var extra []ui.Styling
+	if selected {
+		extra = []ui.Styling{ui.Inverse}
+	}
+	width := 0
+	for i, part := range strings.Split(strings.ReplaceAll(line, "}", "{"), "{") {
+		if i%2 == 1 {
+			b.Write(part, append(extra, ui.Underlined)...)
+		} else {
+			b.Write(part, extra...)
+		}
+		width += wcwidth.Of(part)
+	}
+	if selected && width < b.Width {
+		b.Write(strings.Repeat(" ", b.Width-width), extra...)
+	}
+}
+
+func TestStart_NoColor(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	Start(f.App, Config{Store: testStore{storedDirs: dirs}, NoColor: true})
+	// The mode line is bold but not colored; the content is the same.
+	b := term.NewBufferBuilder(50).Newline().
+		Write(" LOCATION ", ui.Bold).Write(" ").SetDotHere()
+	b.Newline()
+	writeLine(b, "200 "+fix("/usr/bin"), true)
+	b.Newline()
+	writeLine(b, " 50 "+fix("/tmp"), false)
+	f.TTY.TestBuffer(t, b.Buffer())
+	if got, want := b.Buffer().PlainString(),
+		listingBuf("", "200 "+fix("/usr/bin"), "<- selected", " 50 "+fix("/tmp")).
+			PlainString(); got != want {
+		t.Errorf("got content %q, want %q", got, want)
+	}
+}
+
+func TestStart_ColorByScore(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 300},
+		{Path: fix("/usr"), Score: 150},
+		{Path: fix("/tmp"), Score: 30},
+	}
+	Start(f.App, Config{
+		Store:         testStore{storedDirs: dirs},
+		IteratePinned: func(f func(string)) { f(fix("/opt")) },
+		ColorByScore:  true,
+	})
+	b := term.NewBufferBuilder(50).Newline()
+	cli.WriteListing(b, " LOCATION ", "")
+	b.Newline()
+	writeLine(b, "  * "+fix("/opt"), true)
+	b.Newline().Write("300", ui.Bold, ui.FgBrightGreen).Write(" " + fix("/usr/bin"))
+	b.Newline().Write("150", ui.FgGreen).Write(" " + fix("/usr"))
+	b.Newline().Write(" 30", ui.Dim).Write(" " + fix("/tmp"))
+	f.TTY.TestBuffer(t, b.Buffer())
+
+	// Scores are relative to the highest shown score.
+	f.TTY.Inject(term.K('t'), term.K('m'))
+	b = term.NewBufferBuilder(50).Newline()
+	cli.WriteListing(b, " LOCATION ", "tm")
+	b.Newline().
+		Write(" 30", ui.Bold, ui.FgBrightGreen, ui.Inverse).
+		Write(" "+fix("/"), ui.Inverse).Write("tm", ui.Inverse, ui.Underlined).
+		Write("p"+strings.Repeat(" ", 50-len(" 30 "+fix("/tmp"))), ui.Inverse)
+	f.TTY.TestBuffer(t, b.Buffer())
+}
+
+func TestStart_ColorByScore_NoColor(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	Start(f.App, Config{
+		Store: testStore{storedDirs: dirs}, NoColor: true, ColorByScore: true})
+	// The scores are not styled.
+	b := term.NewBufferBuilder(50).Newline().
+		Write(" LOCATION ", ui.Bold).Write(" ").SetDotHere()
+	b.Newline()
+	writeLine(b, "200 "+fix("/usr/bin"), true)
+	b.Newline()
+	writeLine(b, " 50 "+fix("/tmp"), false)
+	f.TTY.TestBuffer(t, b.Buffer())
+}
+
+func TestScoreStyling(t *testing.T) {
+	tt.Test(t, tt.Fn("scoreStyling", scoreStyling), tt.Table{
+		tt.Args(100.0, 100.0).Rets(scoreStylings[2]),
+		tt.Args(70.0, 100.0).Rets(scoreStylings[2]),
+		tt.Args(50.0, 100.0).Rets(scoreStylings[1]),
+		tt.Args(10.0, 100.0).Rets(scoreStylings[0]),
+		tt.Args(0.0, 0.0).Rets(scoreStylings[0]),
+		tt.Args(pinnedScore, 100.0).Rets(nil),
+		tt.Args(cwdScore, 100.0).Rets(nil),
+	})
+}
+
+func TestStart_OnEmpty(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	emptyCh := make(chan string, 100)
+	dirs := []store.Dir{{Path: fix("/tmp"), Score: 50}}
+	Start(f.App, Config{
+		Store:   testStore{storedDirs: dirs},
+		OnEmpty: func(query string) { emptyCh <- query },
+	})
+	f.TTY.TestBuffer(t, listingBuf("", " 50 "+fix("/tmp"), "<- selected"))
+
+	f.TTY.Inject(term.K('x'))
+	f.TTY.TestBuffer(t, noMatchesBuf("x"))
+	if got := <-emptyCh; got != "x" {
+		t.Errorf("OnEmpty called with %q, want %q", got, "x")
+	}
+
+	// Accepting the note does nothing.
+	f.TTY.Inject(term.K(ui.Enter))
+	f.TTY.Inject(term.K(ui.Backspace))
+	f.TTY.TestBuffer(t, listingBuf("", " 50 "+fix("/tmp"), "<- selected"))
+	select {
+	case query := <-emptyCh:
+		t.Errorf("OnEmpty called with %q when there are matches", query)
+	default:
+	}
+}
+
+func noMatchesBuf(filter string) *term.Buffer {
+	b := term.NewBufferBuilder(50).Newline()
+	cli.WriteListing(b, " LOCATION ", filter)
+	b.Newline().Write("no matches", ui.Dim)
+	return b.Buffer()
+}
+
+func loadingBuf(filter string) *term.Buffer {
+	b := term.NewBufferBuilder(50).Newline()
+	cli.WriteListing(b, " LOCATION ", filter)
+	b.Newline().Write("loading…", ui.Dim)
+	return b.Buffer()
+}
+
+func fix(path string) string {
+	if runtime.GOOS != "windows" {
+		return path
+	}
+	if path[0] == '/' {
+		path = "C:" + path
+	}
+	return strings.ReplaceAll(path, "/", "\\")
+}
+
+func TestStart_Preview(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 50},
+	}
+	previewCh := make(chan string, 100)
+	Start(f.App, Config{
+		Store: testStore{storedDirs: dirs},
+		Preview: func(path string) ui.Text {
+			previewCh <- path
+			return ui.T("contents of " + path)
+		},
+	})
+	f.TTY.TestBuffer(t, previewBuf(fix("/usr/bin"),
+		"200 "+fix("/usr/bin"), "<- selected",
+		" 50 "+fix("/tmp")))
+
+	f.TTY.Inject(term.K(ui.Down))
+	f.TTY.TestBuffer(t, previewBuf(fix("/tmp"),
+		"200 "+fix("/usr/bin"),
+		" 50 "+fix("/tmp"), "<- selected"))
+
+	f.TTY.Inject(term.K(ui.Up))
+	f.TTY.TestBuffer(t, previewBuf(fix("/usr/bin"),
+		"200 "+fix("/usr/bin"), "<- selected",
+		" 50 "+fix("/tmp")))
+
+	// The preview of each directory is only computed once.
+	var previewed []string
+	for len(previewCh) > 0 {
+		previewed = append(previewed, <-previewCh)
+	}
+	if want := []string{fix("/usr/bin"), fix("/tmp")}; !reflect.DeepEqual(previewed, want) {
+		t.Errorf("Preview called with %v, want %v", previewed, want)
+	}
+}
+
+func TestStart_PanickingPreview(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{{Path: fix("/tmp"), Score: 50}}
+	Start(f.App, Config{
+		Store:   testStore{storedDirs: dirs},
+		Preview: func(string) ui.Text { panic("boom") },
+	})
+	f.TestTTYNotes(t, "addon error: boom")
+	// The addon stays open with an empty preview, and keeps handling events.
+	f.TTY.Inject(term.K('t'))
+	b := listingBuf("t", " 50 "+fix("/")+"{t}mp", "<- selected")
+	b.Extend(term.NewBufferBuilder(50).Buffer(), false)
+	f.TTY.TestBuffer(t, b)
+}
+
+func previewBuf(path string, lines ...string) *term.Buffer {
+	b := listingBuf("", lines...)
+	bb := term.NewBufferBuilder(50).Write("contents of " + path)
+	b.Extend(bb.Buffer(), false)
+	return b
+}
+
+func TestStart_QuickJump(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	var clockMutex sync.Mutex
+	clock := time.Now()
+	advance := func(d time.Duration) {
+		clockMutex.Lock()
+		defer clockMutex.Unlock()
+		clock = clock.Add(d)
+	}
+	now := func() time.Time {
+		clockMutex.Lock()
+		defer clockMutex.Unlock()
+		return clock
+	}
+
+	dirs := []store.Dir{
+		{Path: fix("/tmp"), Score: 40},
+		{Path: fix("/usr/bin"), Score: 30},
+		{Path: fix("/home/bar"), Score: 20},
+		{Path: fix("/usr/bash"), Score: 10},
+	}
+	Start(f.App, Config{Store: testStore{storedDirs: dirs}, QuickJump: true, Now: now})
+	shown := []string{
+		" 40 " + fix("/tmp"), " 30 " + fix("/usr/bin"),
+		" 20 " + fix("/home/bar"), " 10 " + fix("/usr/bash")}
+	lines := func(selected int) []string {
+		var lines []string
+		for i, line := range shown {
+			lines = append(lines, line)
+			if i == selected {
+				lines = append(lines, "<- selected")
+			}
+		}
+		return lines
+	}
+	f.TTY.TestBuffer(t, listingBuf("", lines(0)...))
+
+	// The first character jumps to the next matching directory.
+	f.TTY.Inject(term.K('b'))
+	f.TTY.TestBuffer(t, listingBuf("", lines(1)...))
+	// Characters typed soon after extend the prefix.
+	advance(quickJumpReset / 2)
+	f.TTY.Inject(term.K('A'))
+	f.TTY.TestBuffer(t, listingBuf("", lines(2)...))
+	// After being idle, the prefix starts over.
+	advance(2 * quickJumpReset)
+	f.TTY.Inject(term.K('b'))
+	f.TTY.TestBuffer(t, listingBuf("", lines(3)...))
+	// The search wraps around.
+	advance(2 * quickJumpReset)
+	f.TTY.Inject(term.K('t'))
+	f.TTY.TestBuffer(t, listingBuf("", lines(0)...))
+	// Nothing matches; the selection is kept.
+	f.TTY.Inject(term.K('x'))
+	f.TTY.TestBuffer(t, listingBuf("", lines(0)...))
+}
+
+type timeStore struct {
+	testStore
+	times map[string]time.Time
+}
+
+func (ts timeStore) VisitTimes() (map[string]time.Time, error) {
+	return ts.times, nil
+}
+
+func TestStart_ShowTime(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	t0 := time.Date(2020, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/usr"), Score: 150},
+		{Path: fix("/tmp"), Score: 100},
+		{Path: fix("/opt"), Score: 50},
+		{Path: fix("/var"), Score: 20},
+	}
+	Start(f.App, Config{
+		Store: timeStore{testStore{storedDirs: dirs}, map[string]time.Time{
+			fix("/usr/bin"): t0.Add(-30 * time.Second),
+			fix("/usr"):     t0.Add(-5 * time.Minute),
+			fix("/tmp"):     t0.Add(-3 * time.Hour),
+			fix("/opt"):     t0.Add(-50 * time.Hour),
+		}},
+		IteratePinned: func(f func(string)) { f(fix("/home")) },
+		ShowTime:      true,
+		Now:           func() time.Time { return t0 },
+	})
+	// Directories without times, like pinned ones, have empty times.
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"  *        "+fix("/home"), "<- selected",
+		"200    now "+fix("/usr/bin"),
+		"150 5m ago "+fix("/usr"),
+		"100 3h ago "+fix("/tmp"),
+		" 50 2d ago "+fix("/opt"),
+		" 20        "+fix("/var")))
+}
+
+func TestStart_ShowTime_ZeroTimes(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	t0 := time.Date(2020, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	// Stores written by older versions may have zero times for directories
+	// visited before times were recorded; they are treated as unknown.
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 100},
+		{Path: fix("/opt"), Score: 50},
+	}
+	ts := timeStore{testStore{storedDirs: dirs}, map[string]time.Time{
+		fix("/usr/bin"): {},
+		fix("/tmp"):     t0.Add(-5 * time.Minute),
+		fix("/opt"):     {},
+	}}
+	now := func() time.Time { return t0 }
+	Start(f.App, Config{Store: ts, ShowTime: true, Now: now})
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200        "+fix("/usr/bin"), "<- selected",
+		"100 5m ago "+fix("/tmp"),
+		" 50        "+fix("/opt")))
+
+	f2 := Setup()
+	defer f2.Stop()
+	Start(f2.App, Config{
+		Store: ts, AbsolutePaths: true, SplitFrequentRecent: true, Now: now})
+	f2.TTY.TestBuffer(t, groupedBuf(
+		"",
+		"frequent", header,
+		"  200 "+fix("/usr/bin"), cli.Selected,
+		"   50 "+fix("/opt"),
+		"recent", header,
+		"  100 "+fix("/tmp")))
+}
+
+func TestStart_WrapSelection(t *testing.T) {
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 100},
+	}
+	lines := func(selected int) []string {
+		l := []string{"200 " + fix("/usr/bin"), "100 " + fix("/tmp")}
+		return append(l[:selected+1:selected+1], append([]string{"<- selected"}, l[selected+1:]...)...)
+	}
+
+	t.Run("on", func(t *testing.T) {
+		f := Setup()
+		defer f.Stop()
+		Start(f.App, Config{Store: testStore{storedDirs: dirs}, WrapSelection: true})
+		f.TTY.TestBuffer(t, listingBuf("", lines(0)...))
+		// Up at the top wraps to the bottom.
+		f.TTY.Inject(term.K(ui.Up))
+		f.TTY.TestBuffer(t, listingBuf("", lines(1)...))
+		// Down at the bottom wraps to the top.
+		f.TTY.Inject(term.K(ui.Down))
+		f.TTY.TestBuffer(t, listingBuf("", lines(0)...))
+	})
+
+	t.Run("off", func(t *testing.T) {
+		f := Setup()
+		defer f.Stop()
+		Start(f.App, Config{Store: testStore{storedDirs: dirs}})
+		f.TTY.TestBuffer(t, listingBuf("", lines(0)...))
+		// Up at the top stays.
+		f.TTY.Inject(term.K(ui.Up), term.K('t'), term.K(ui.Backspace))
+		f.TTY.TestBuffer(t, listingBuf("", lines(0)...))
+		// Down at the bottom stays.
+		f.TTY.Inject(term.K(ui.Down), term.K(ui.Down), term.K('t'), term.K(ui.Backspace))
+		f.TTY.TestBuffer(t, listingBuf("", lines(1)...))
+	})
+}
+
+func TestStart_WrapSelection_GroupByParent(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 100},
+	}
+	Start(f.App, Config{
+		Store:         testStore{storedDirs: dirs},
+		AbsolutePaths: true,
+		GroupByParent: true,
+		WrapSelection: true,
+	})
+	f.TTY.TestBuffer(t, groupedBuf(
+		"",
+		fix("/usr"), header,
+		"  200 bin", cli.Selected,
+		fix("/"), header,
+		"  100 tmp"))
+
+	// Up from the first entry wraps to the last, skipping the header.
+	f.TTY.Inject(term.K(ui.Up))
+	f.TTY.TestBuffer(t, groupedBuf(
+		"",
+		fix("/usr"), header,
+		"  200 bin",
+		fix("/"), header,
+		"  100 tmp", cli.Selected))
+
+	// Down from the last entry wraps to the first, skipping the header.
+	f.TTY.Inject(term.K(ui.Down))
+	f.TTY.TestBuffer(t, groupedBuf(
+		"",
+		fix("/usr"), header,
+		"  200 bin", cli.Selected,
+		fix("/"), header,
+		"  100 tmp"))
+}
+
+func TestStart_SplitFrequentRecent(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	t0 := time.Date(2020, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 100},
+		{Path: fix("/opt"), Score: 50},
+		{Path: fix("/var"), Score: 20},
+	}
+	Start(f.App, Config{
+		Store: timeStore{testStore{storedDirs: dirs}, map[string]time.Time{
+			fix("/usr/bin"): t0.Add(-50 * time.Hour),
+			fix("/tmp"):     t0.Add(-time.Hour),
+			fix("/opt"):     t0.Add(-10 * time.Minute),
+		}},
+		AbsolutePaths:       true,
+		SplitFrequentRecent: true,
+		Now:                 func() time.Time { return t0 },
+	})
+	// The first header is skipped when selecting the first entry.
+	f.TTY.TestBuffer(t, groupedBuf(
+		"",
+		"frequent", header,
+		"  200 "+fix("/usr/bin"), cli.Selected,
+		"   20 "+fix("/var"),
+		"recent", header,
+		"   50 "+fix("/opt"),
+		"  100 "+fix("/tmp")))
+
+	// Navigation flows across the sections, skipping the headers.
+	f.TTY.Inject(term.K(ui.Down), term.K(ui.Down))
+	f.TTY.TestBuffer(t, groupedBuf(
+		"",
+		"frequent", header,
+		"  200 "+fix("/usr/bin"),
+		"   20 "+fix("/var"),
+		"recent", header,
+		"   50 "+fix("/opt"), cli.Selected,
+		"  100 "+fix("/tmp")))
+
+	f.TTY.Inject(term.K(ui.Up))
+	f.TTY.TestBuffer(t, groupedBuf(
+		"",
+		"frequent", header,
+		"  200 "+fix("/usr/bin"),
+		"   20 "+fix("/var"), cli.Selected,
+		"recent", header,
+		"   50 "+fix("/opt"),
+		"  100 "+fix("/tmp")))
+}
+
+func TestStart_SplitFrequentRecent_Now(t *testing.T) {
+	t0 := time.Date(2020, 1, 10, 12, 0, 0, 0, time.UTC)
+	st := timeStore{testStore{storedDirs: []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 100},
+	}}, map[string]time.Time{
+		fix("/usr/bin"): t0.Add(-2 * time.Hour),
+		fix("/tmp"):     t0.Add(-time.Hour),
+	}}
+	tests := []struct {
+		name string
+		now  time.Time
+		want []string
+	}{
+		{"both recent", t0, []string{
+			"recent", header,
+			"  100 " + fix("/tmp"), cli.Selected,
+			"  200 " + fix("/usr/bin")}},
+		{"one no longer recent", t0.Add(22*time.Hour + 30*time.Minute), []string{
+			"frequent", header,
+			"  200 " + fix("/usr/bin"), cli.Selected,
+			"recent", header,
+			"  100 " + fix("/tmp")}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := Setup()
+			defer f.Stop()
+			Start(f.App, Config{
+				Store: st, AbsolutePaths: true, SplitFrequentRecent: true,
+				Now: func() time.Time { return test.now }})
+			f.TTY.TestBuffer(t, groupedBuf("", test.want...))
+		})
+	}
+}
+
+func TestStart_SplitFrequentRecent_NoTimeStore(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 100},
+	}
+	Start(f.App, Config{
+		Store:               testStore{storedDirs: dirs},
+		AbsolutePaths:       true,
+		SplitFrequentRecent: true,
+	})
+	// Without visit times, all directories are frequent.
+	f.TTY.TestBuffer(t, groupedBuf(
+		"",
+		"frequent", header,
+		"  200 "+fix("/usr/bin"), cli.Selected,
+		"  100 "+fix("/tmp")))
+}
+
+func TestStart_ShowTime_FormatTime(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	t0 := time.Date(2020, 1, 10, 12, 0, 0, 0, time.UTC)
+	dirs := []store.Dir{{Path: fix("/tmp"), Score: 100}}
+	Start(f.App, Config{
+		Store: timeStore{testStore{storedDirs: dirs},
+			map[string]time.Time{fix("/tmp"): t0}},
+		ShowTime:   true,
+		FormatTime: func(t time.Time) string { return t.Format("2006-01-02") },
+	})
+	f.TTY.TestBuffer(t, listingBuf("", "100 2020-01-10 "+fix("/tmp"), "<- selected"))
+}
+
+func TestStart_ShowTime_NoTimeStore(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{{Path: fix("/tmp"), Score: 100}}
+	Start(f.App, Config{Store: testStore{storedDirs: dirs}, ShowTime: true})
+	f.TTY.TestBuffer(t, listingBuf("", "100 "+fix("/tmp"), "<- selected"))
+}
+
+type panickingTimeStore struct{ testStore }
+
+func (panickingTimeStore) VisitTimes() (map[string]time.Time, error) {
+	panic("boom")
+}
+
+func TestStart_PanickingVisitTimes(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{{Path: fix("/tmp"), Score: 100}}
+	Start(f.App, Config{
+		Store:    panickingTimeStore{testStore{storedDirs: dirs}},
+		ShowTime: true,
+	})
+	f.TestTTYNotes(t, "addon error: boom")
+	// The directories are shown without times.
+	f.TTY.TestBuffer(t, listingBuf("", "100 "+fix("/tmp"), "<- selected"))
+}
+
+func TestStart_PanickingFormatTime(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{{Path: fix("/tmp"), Score: 100}}
+	Start(f.App, Config{
+		Store: timeStore{testStore{storedDirs: dirs},
+			map[string]time.Time{fix("/tmp"): time.Now()}},
+		ShowTime:   true,
+		FormatTime: func(time.Time) string { panic("boom") },
+	})
+	f.TestTTYNotes(t, "addon error: boom")
+	f.TTY.TestBuffer(t, listingBuf("", "100 "+fix("/tmp"), "<- selected"))
+}
+
+func TestStart_ViKeys(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/usr/bin"), Score: 200},
+		{Path: fix("/tmp"), Score: 100},
+		{Path: fix("/home"), Score: 50},
+	}
+	Start(f.App, Config{Store: testStore{storedDirs: dirs}, ViKeys: true})
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"), "<- selected",
+		"100 "+fix("/tmp"),
+		" 50 "+fix("/home")))
+
+	f.TTY.Inject(term.K('j'), term.K('j'), term.K('k'))
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"200 "+fix("/usr/bin"),
+		"100 "+fix("/tmp"), "<- selected",
+		" 50 "+fix("/home")))
+
+	// / starts filtering.
+	f.TTY.Inject(term.K('/'), term.K('h'), term.K('o'))
+	f.TTY.TestBuffer(t, listingBuf("ho", " 50 "+fix("/")+"{ho}me", "<- selected"))
+
+	// Escape stops filtering; the filter is kept.
+	f.TTY.Inject(term.K('[', ui.Ctrl), term.K('j'), term.K('m'))
+	f.TTY.TestBuffer(t, listingBuf("ho", " 50 "+fix("/")+"{ho}me", "<- selected"))
+}
+
+func TestStart_SmartRank(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	dirs := []store.Dir{
+		{Path: fix("/a/foo/bar"), Score: 100},
+		{Path: fix("/y/barfoo"), Score: 60},
+		{Path: fix("/x/foo"), Score: 40},
+	}
+	Start(f.App, Config{Store: testStore{storedDirs: dirs}, SmartRank: true})
+
+	// Without a filter, directories are ordered by score.
+	f.TTY.TestBuffer(t, listingBuf(
+		"",
+		"100 "+fix("/a/foo/bar"), "<- selected",
+		" 60 "+fix("/y/barfoo"),
+		" 40 "+fix("/x/foo")))
+
+	// A prefix match of the base name outweighs a contained match, which
+	// outweighs a match elsewhere in the path.
+	f.TTY.Inject(term.K('f'), term.K('o'), term.K('o'))
+	f.TTY.TestBuffer(t, listingBuf(
+		"foo",
+		" 40 "+fix("/x/")+"{foo}", "<- selected",
+		" 60 "+fix("/y/bar")+"{foo}",
+		"100 "+fix("/a/")+"{foo}"+fix("/bar")))
 }
@@ -0,0 +1,65 @@
+package location
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/elves/elvish/pkg/store"
+)
+
+// The number of directories to check concurrently when pruning missing
+// directories.
+const pruneWorkers = 8
+
+// Returns the directories that still exist, preserving the order. The expand
+// function converts the path of a directory to the path to check.
+func pruneMissing(dirs []store.Dir, expand func(string) string, timeout time.Duration) []store.Dir {
+	exists := make([]bool, len(dirs))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < pruneWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				exists[i] = dirExists(expand(dirs[i].Path), timeout)
+			}
+		}()
+	}
+	for i := range dirs {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	var pruned []store.Dir
+	for i, dir := range dirs {
+		if exists[i] {
+			pruned = append(pruned, dir)
+		}
+	}
+	return pruned
+}
+
+// Returns whether path is a directory. If timeout is positive and the check
+// takes longer than timeout, it returns true.
+func dirExists(path string, timeout time.Duration) bool {
+	if timeout <= 0 {
+		return isDir(path)
+	}
+	// Buffered so that the goroutine can exit after a timeout.
+	resultCh := make(chan bool, 1)
+	go func() { resultCh <- isDir(path) }()
+	select {
+	case exists := <-resultCh:
+		return exists
+	case <-time.After(timeout):
+		return true
+	}
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,132 @@
+package location
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/elves/elvish/pkg/store"
+)
+
+// Combines Config.Store and Config.Stores into Config.Store.
+func combineStores(cfg *Config) {
+	if len(cfg.Stores) == 0 {
+		return
+	}
+	var stores multiStore
+	if cfg.Store != nil {
+		stores = append(stores, cfg.Store)
+	}
+	stores = append(stores, cfg.Stores...)
+	cfg.Store, cfg.Stores = stores, nil
+}
+
+// A Store backed by multiple stores.
+type multiStore []Store
+
+// Dirs merges the directories from all the stores, summing the scores of
+// directories with the same path. The result is sorted by score in descending
+// order. If any store returns an error, the first error is returned along with
+// the directories from the other stores.
+func (ms multiStore) Dirs(blacklist map[string]struct{}) ([]store.Dir, error) {
+	return ms.DirsContext(context.Background(), blacklist)
+}
+
+// DirsContext is like Dirs, but passes ctx to the stores that implement
+// ContextStore.
+func (ms multiStore) DirsContext(ctx context.Context, blacklist map[string]struct{}) ([]store.Dir, error) {
+	var dirs []store.Dir
+	index := map[string]int{}
+	var firstErr error
+	for _, s := range ms {
+		storeDirs, err := dirsContext(ctx, s, blacklist)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		for _, dir := range storeDirs {
+			if i, ok := index[dir.Path]; ok {
+				dirs[i].Score += dir.Score
+				continue
+			}
+			index[dir.Path] = len(dirs)
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.SliceStable(dirs, func(i, j int) bool { return dirs[i].Score > dirs[j].Score })
+	return dirs, firstErr
+}
+
+// Chdir calls Chdir of each store in turn until one succeeds. If none succeeds,
+// the error from the last store is returned.
+func (ms multiStore) Chdir(dir string) error {
+	var err error
+	for _, s := range ms {
+		err = s.Chdir(dir)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// Getwd calls Getwd of the first store.
+func (ms multiStore) Getwd() (string, error) {
+	return ms[0].Getwd()
+}
+
+// DecayScores decays the scores in all the stores that implement DecayStore.
+// If none does, errNoDecay is returned. Otherwise the first error from the
+// stores is returned, after all of them have been tried.
+func (ms multiStore) DecayScores(factor float64) error {
+	supported := false
+	var firstErr error
+	for _, s := range ms {
+		if ds, ok := s.(DecayStore); ok {
+			supported = true
+			if err := ds.DecayScores(factor); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if !supported {
+		return errNoDecay
+	}
+	return firstErr
+}
+
+// Bump bumps the directory in the first store that implements BumpStore, like
+// Chdir changes to the directory in the first store that succeeds. If no store
+// implements BumpStore, errNoBump is returned.
+func (ms multiStore) Bump(path string) error {
+	for _, s := range ms {
+		if bs, ok := s.(BumpStore); ok {
+			return bs.Bump(path)
+		}
+	}
+	return errNoBump
+}
+
+// VisitTimes merges the visit times from all the stores that implement
+// TimeStore, keeping the latest time of directories with the same path. If any
+// store returns an error, the first error is returned along with the times from
+// the other stores.
+func (ms multiStore) VisitTimes() (map[string]time.Time, error) {
+	times := map[string]time.Time{}
+	var firstErr error
+	for _, s := range ms {
+		ts, ok := s.(TimeStore)
+		if !ok {
+			continue
+		}
+		storeTimes, err := ts.VisitTimes()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		for path, t := range storeTimes {
+			if t.After(times[path]) {
+				times[path] = t
+			}
+		}
+	}
+	return times, firstErr
+}
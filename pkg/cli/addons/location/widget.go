@@ -0,0 +1,741 @@
+package location
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/elves/elvish/pkg/cli"
+	"github.com/elves/elvish/pkg/cli/addons/navigation"
+	"github.com/elves/elvish/pkg/cli/term"
+	"github.com/elves/elvish/pkg/store"
+	"github.com/elves/elvish/pkg/ui"
+	"github.com/elves/elvish/pkg/wcwidth"
+)
+
+// The location addon: a ComboBox listing the directories, along with the
+// state its handlers need.
+type widget struct {
+	cli.ComboBox
+	Config
+	app cli.App
+	// The widget that is actually shown; differs from the widget itself when
+	// there is a preview pane.
+	addon cli.Widget
+	// Canceled when the addon is closed, or when there is nothing more to
+	// load.
+	ctx    context.Context
+	cancel func()
+	// Handlers of the keys of the addon, after Config.Binding.
+	actions cli.MapHandler
+
+	// Protects the fields below, which are updated when the directories are
+	// loaded and accessed from the handlers, which may run in other
+	// goroutines.
+	mutex sync.Mutex
+	list  list
+	ws    workspace
+	// The resolved path shown for confirmation, and the path it was resolved
+	// from; both empty when not confirming.
+	confirmPath, confirmResolved string
+	// The last selected index, used to skip group headers in the direction
+	// the selection moves.
+	lastSelected int
+
+	// The characters typed for quick jumping, and when the last one was typed.
+	// Only accessed from the event loop.
+	jumpPrefix string
+	jumpTime   time.Time
+
+	// Protects the state of debouncing filtering: the last query the
+	// directories were filtered with, and the function canceling the pending
+	// filtering, if any.
+	debounceMutex sync.Mutex
+	filteredQuery string
+	stopPending   func() bool
+}
+
+// Creates the widget. The directories are not loaded yet. The Config must
+// already have its defaults filled in.
+func newWidget(app cli.App, cfg Config) *widget {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &widget{Config: cfg, app: app, ctx: ctx, cancel: cancel,
+		list: list{loading: true, showPath: makeShowPath(cfg), pinnedMarker: "*",
+			matchBase: cfg.MatchBasenameOnly, maxPathLen: cfg.MaxPathLen},
+		lastSelected: -1}
+	if cfg.PinnedMarker != "" {
+		w.list.pinnedMarker = cfg.PinnedMarker
+	}
+	if cfg.MultiSelect {
+		w.list.marked = map[string]bool{}
+	}
+
+	// Keys are only bound when the feature is configured, so that they are
+	// otherwise left to the ComboBox.
+	w.actions = cli.MapHandler{}
+	if cfg.DeleteEntry != nil {
+		w.actions[term.K(ui.Backspace, ui.Alt)] = w.deleteEntry
+	}
+	if cfg.SavePinned != nil {
+		w.actions[term.K(ui.Up, ui.Alt)] = func() { w.movePinned(-1) }
+		w.actions[term.K(ui.Down, ui.Alt)] = func() { w.movePinned(1) }
+	}
+	if cfg.Pin != nil {
+		w.actions[term.K('P', ui.Alt)] = w.pinSelected
+	}
+	if cfg.ToggleOrder {
+		w.actions[term.K('S', ui.Alt)] = w.toggleOrder
+	}
+	if cfg.OpenInEditor != nil {
+		w.actions[term.K('E', ui.Alt)] = w.openInEditor
+	}
+	if cfg.CopyPath != nil {
+		w.actions[term.K('C', ui.Alt)] = w.copyPath
+	}
+	if cfg.NavigationBinding != nil {
+		w.actions[term.K(ui.Tab)] = w.navigate
+	}
+	if cfg.MultiSelect {
+		w.actions[term.K(' ')] = w.toggleMarked
+	}
+	for key, action := range cfg.AcceptWith {
+		action := action
+		w.actions[term.KeyEvent(key)] = func() { w.acceptWith(action) }
+	}
+	for _, key := range cfg.CancelKeys {
+		w.actions[term.KeyEvent(key)] = w.closeAddon
+	}
+
+	filter := cfg.InitialFilter
+	if filter == "" && cfg.RememberFilter {
+		filter = getLastFilter()
+	}
+	w.filteredQuery = filter
+
+	// Handlers of the widget. Since they call user-supplied callbacks, they are
+	// called with cli.CatchPanic.
+	w.ComboBox = cli.NewComboBox(cli.ComboBoxSpec{
+		ViKeys: cfg.ViKeys,
+		CodeArea: cli.CodeAreaSpec{
+			Prompt: w.prompt,
+			State: cli.CodeAreaState{
+				Buffer: cli.CodeBuffer{Content: filter, Dot: len(filter)}},
+		},
+		ListBox: cli.ListBoxSpec{
+			Wrap:            cfg.WrapSelection,
+			CtrlPageKeys:    true,
+			ShowScrollbar:   cfg.ShowScrollbar,
+			SelectedStyling: cfg.SelectedStyle,
+			OverlayHandler: cli.FuncHandler(func(event term.Event) (handled bool) {
+				cli.CatchPanic(app, func() { handled = w.handleOverlay(event) })
+				return handled
+			}),
+			OnSelect: func(it cli.Items, i int) {
+				if cfg.GroupByParent || cfg.SplitFrequentRecent {
+					w.skipHeader(it, i)
+				}
+			},
+			OnAccept: func(it cli.Items, i int) {
+				cli.CatchPanic(app, func() { w.accept(it, i) })
+			},
+		},
+		OnFilter: func(cb cli.ComboBox, p string) {
+			if cfg.FilterDebounce > 0 {
+				w.debounceFilter(cb, p)
+				return
+			}
+			cli.CatchPanic(app, func() { w.filterDirs(cb, p) })
+		},
+	})
+	w.addon = w
+	if cfg.Preview != nil {
+		w.addon = &previewWidget{w, app, w.selectedPath, cfg.Preview, map[string]ui.Text{}}
+	}
+	return w
+}
+
+func (w *widget) getState() (list, workspace) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.list, w.ws
+}
+
+func (w *widget) setDirs(dirs []store.Dir) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.list.dirs = dirs
+}
+
+func (w *widget) getConfirm() (string, string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.confirmPath, w.confirmResolved
+}
+
+func (w *widget) setConfirm(path, resolved string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.confirmPath, w.confirmResolved = path, resolved
+}
+
+// Closes the addon if it is still shown, canceling the loading.
+func (w *widget) closeAddon() {
+	w.cancel()
+	w.app.MutateState(func(s *cli.State) {
+		if s.Addon == w.addon {
+			s.Addon = nil
+		}
+	})
+	w.app.Redraw()
+}
+
+// Returns whether the addon is still shown.
+func (w *widget) shown() bool {
+	return w.app.CopyState().Addon == w.addon
+}
+
+// Calls f with the path of the selected directory, if there is one.
+func (w *widget) withSelected(f func(path string)) {
+	state := w.ListBox().CopyState()
+	if path, ok := state.Items.(list).pathAt(state.Selected); ok {
+		f(path)
+	}
+}
+
+// Returns the expanded path of the selected directory, and whether there is
+// one.
+func (w *widget) selectedPath() (string, bool) {
+	var path string
+	var ok bool
+	w.withSelected(func(p string) {
+		_, ws := w.getState()
+		path, ok = ws.expand(p), true
+	})
+	return path, ok
+}
+
+// Selects the directory with the given path, if it is shown.
+func (w *widget) selectPath(path string) {
+	w.ListBox().Select(func(s cli.ListBoxState) int {
+		if i := s.Items.(list).indexOfPath(path); i != -1 {
+			return i
+		}
+		return s.Selected
+	})
+}
+
+// Moves the selection off a group header at i, in the direction the selection
+// moved.
+func (w *widget) skipHeader(it cli.Items, i int) {
+	w.mutex.Lock()
+	last := w.lastSelected
+	w.lastSelected = i
+	w.mutex.Unlock()
+	headers := it.(list).headers
+	if !headers[i] {
+		return
+	}
+	up := i < last
+	if w.WrapSelection && i == 0 && last == it.Len()-1 {
+		// Wrapped around from the last entry.
+		up = false
+	}
+	next := i + 1
+	if up || next == it.Len() {
+		next = i - 1
+	}
+	if next < 0 {
+		// Moved up to the first header.
+		if w.WrapSelection {
+			next = it.Len() - 1
+		} else {
+			next = i + 1
+		}
+	}
+	if next >= it.Len() || headers[next] {
+		return
+	}
+	w.ListBox().Select(func(cli.ListBoxState) int { return next })
+}
+
+// Moves the selected pinned directory by delta among pinned directories.
+func (w *widget) movePinned(delta int) {
+	if l, _ := w.getState(); l.byPath {
+		// The order of pinned directories is not visible.
+		return
+	}
+	w.withSelected(func(path string) {
+		l, _ := w.getState()
+		i := indexOfPath(l.dirs, path)
+		j := i + delta
+		if i == -1 || j < 0 || j >= len(l.dirs) ||
+			l.dirs[i].Score != pinnedScore || l.dirs[j].Score != pinnedScore {
+			return
+		}
+		dirs := append([]store.Dir(nil), l.dirs...)
+		dirs[i], dirs[j] = dirs[j], dirs[i]
+		var pinned []string
+		for _, dir := range dirs {
+			if dir.Score == pinnedScore {
+				pinned = append(pinned, dir.Path)
+			}
+		}
+		err := w.SavePinned(pinned)
+		if err != nil {
+			w.app.Notify(err.Error())
+			return
+		}
+		w.setDirs(dirs)
+		w.Refilter()
+		w.selectPath(path)
+	})
+}
+
+func (w *widget) deleteEntry() {
+	w.withSelected(func(path string) {
+		err := w.DeleteEntry(path)
+		if err != nil {
+			w.app.Notify(err.Error())
+			return
+		}
+		l, _ := w.getState()
+		i := indexOfPath(l.dirs, path)
+		if i == -1 {
+			// Reloaded without the directory in the meantime.
+			return
+		}
+		w.setDirs(append(l.dirs[:i:i], l.dirs[i+1:]...))
+		selected := w.ListBox().CopyState().Selected
+		w.Refilter()
+		// Select the next directory, which now has the same index.
+		w.ListBox().Select(func(s cli.ListBoxState) int {
+			return fixIndex(selected, len(s.Items.(list).dirs))
+		})
+	})
+}
+
+func (w *widget) pinSelected() {
+	w.withSelected(func(path string) {
+		l, _ := w.getState()
+		i := indexOfPath(l.dirs, path)
+		if i == -1 || l.dirs[i].Score == pinnedScore || l.dirs[i].Score == cwdScore {
+			return
+		}
+		err := w.Pin(path)
+		if err != nil {
+			w.app.Notify(err.Error())
+			return
+		}
+		rest := append(l.dirs[:i:i], l.dirs[i+1:]...)
+		// Keep the working directory first.
+		top := 0
+		if len(rest) > 0 && rest[0].Score == cwdScore {
+			top = 1
+		}
+		dirs := append(rest[:top:top], store.Dir{Path: path, Score: pinnedScore})
+		dirs = append(dirs, rest[top:]...)
+		w.mutex.Lock()
+		w.list.scoreWidth = w.scoreWidth(dirs)
+		w.mutex.Unlock()
+		w.setDirs(dirs)
+		w.Refilter()
+		w.selectPath(path)
+	})
+}
+
+func (w *widget) toggleOrder() {
+	w.mutex.Lock()
+	w.list.byPath = !w.list.byPath
+	w.mutex.Unlock()
+	state := w.ListBox().CopyState()
+	w.Refilter()
+	if path, ok := state.Items.(list).pathAt(state.Selected); ok {
+		w.selectPath(path)
+	}
+}
+
+func (w *widget) openInEditor() {
+	w.withSelected(func(path string) {
+		_, ws := w.getState()
+		err := w.OpenInEditor(ws.expand(path))
+		if err != nil {
+			w.app.Notify(err.Error())
+		}
+		w.closeAddon()
+	})
+}
+
+func (w *widget) copyPath() {
+	w.withSelected(func(path string) {
+		_, ws := w.getState()
+		err := w.CopyPath(ws.expand(path))
+		if err != nil {
+			w.app.Notify(err.Error())
+		}
+	})
+}
+
+func (w *widget) toggleMarked() {
+	w.withSelected(func(path string) {
+		w.mutex.Lock()
+		marked := make(map[string]bool, len(w.list.marked)+1)
+		for p, m := range w.list.marked {
+			marked[p] = m
+		}
+		marked[path] = !marked[path]
+		w.list.marked = marked
+		w.mutex.Unlock()
+		w.Refilter()
+		w.selectPath(path)
+		w.ListBox().Select(cli.Next)
+	})
+}
+
+// Changes to the selected directory like accepting it does, and starts the
+// navigation addon in it.
+func (w *widget) navigate() {
+	w.withSelected(func(path string) {
+		_, ws := w.getState()
+		err := w.chdir(ws.expand(path))
+		if err != nil {
+			w.app.Notify(err.Error())
+			return
+		}
+		// The navigation addon replaces this one.
+		w.cancel()
+		navigation.Start(w.app, navigation.Config{Binding: w.NavigationBinding})
+	})
+}
+
+// Calls action with the selected directory and closes the addon.
+func (w *widget) acceptWith(action func(path string) error) {
+	w.withSelected(func(path string) {
+		_, ws := w.getState()
+		err := action(ws.expand(path))
+		if err != nil {
+			w.app.Notify(err.Error())
+		}
+		w.closeAddon()
+	})
+}
+
+// Moves the selection to the next directory whose base name starts with the
+// characters typed recently, as described in Config.QuickJump. Returns whether
+// event is a character that has been handled.
+func (w *widget) quickJump(event term.Event) bool {
+	k, ok := event.(term.KeyEvent)
+	if !ok || k.Mod != 0 || !unicode.IsPrint(k.Rune) {
+		return false
+	}
+	t := w.Now()
+	// When extending the prefix, the selected directory may still match.
+	from := 0
+	if w.jumpPrefix == "" || t.Sub(w.jumpTime) > quickJumpReset {
+		w.jumpPrefix, from = "", 1
+	}
+	w.jumpPrefix += strings.ToLower(string(k.Rune))
+	w.jumpTime = t
+	prefix := w.jumpPrefix
+	w.ListBox().Select(func(s cli.ListBoxState) int {
+		l := s.Items.(list)
+		for d := from; d < len(l.dirs)+from; d++ {
+			i := (s.Selected + d) % len(l.dirs)
+			path, ok := l.pathAt(i)
+			if ok && strings.HasPrefix(
+				strings.ToLower(filepath.Base(path)), prefix) {
+				return i
+			}
+		}
+		return s.Selected
+	})
+	return true
+}
+
+func (w *widget) prompt() ui.Text {
+	modeLineText := func(s string) ui.Text {
+		if w.NoColor {
+			return cli.ModeLine(s, true).NoColor()
+		}
+		return cli.ModeLine(s, true)
+	}
+	if _, resolved := w.getConfirm(); resolved != "" {
+		return modeLineText(" " + w.ModeLine + " " + resolved + " ")
+	}
+	return modeLineText(" " + w.ModeLine + " ")
+}
+
+func (w *widget) handleOverlay(event term.Event) bool {
+	if path, _ := w.getConfirm(); path != "" && event == term.K('[', ui.Ctrl) {
+		// Cancel the confirmation instead of closing the addon.
+		w.setConfirm("", "")
+		return true
+	}
+	if w.Binding.Handle(event) {
+		if !w.shown() {
+			// Closed by the binding, like the close-listing builtin of the
+			// editor does.
+			w.cancel()
+		}
+		return true
+	}
+	if w.actions.Handle(event) {
+		return true
+	}
+	return w.QuickJump && w.quickJump(event)
+}
+
+func (w *widget) accept(it cli.Items, i int) {
+	if _, ok := it.(list).pathAt(i); !ok {
+		// The note about truncated entries, or a group header.
+		return
+	}
+	l, ws := w.getState()
+	var err error
+	// The accepted directories, as paths in the list.
+	var accepted []string
+	if w.MultiSelect {
+		paths := l.markedPaths()
+		if len(paths) == 0 {
+			paths = []string{it.(list).dirs[i].Path}
+		}
+		accepted = append(accepted, paths...)
+		for i, path := range paths {
+			paths[i] = ws.expand(path)
+		}
+		err = callWithTimeout(func() error { return w.AcceptMulti(paths) }, w.ChdirTimeout)
+	} else {
+		accepted = []string{it.(list).dirs[i].Path}
+		path := ws.expand(it.(list).dirs[i].Path)
+		if w.Confirm {
+			if confirmed, _ := w.getConfirm(); confirmed != path {
+				resolved, err := resolvePath(path)
+				if err != nil {
+					w.app.Notify(err.Error())
+					return
+				}
+				w.setConfirm(path, resolved)
+				return
+			}
+			w.setConfirm("", "")
+		}
+		err = w.chdir(path)
+	}
+	if err != nil {
+		w.app.Notify(err.Error())
+		if w.StayOpenOnError || err == errChdirTimeout {
+			return
+		}
+	} else if w.SuppressRecent > 0 {
+		for _, path := range accepted {
+			addRecentlyAccepted(path, w.SuppressRecent)
+		}
+	}
+	w.closeAddon()
+}
+
+// Calls Accept with the path, and PushUndo with the previous working directory
+// if it succeeds.
+func (w *widget) chdir(path string) error {
+	prev, wdErr := w.Store.Getwd()
+	err := callWithTimeout(func() error { return w.Accept(path) }, w.ChdirTimeout)
+	if err == nil && wdErr == nil && w.PushUndo != nil {
+		w.PushUndo(prev)
+	}
+	return err
+}
+
+// Returns the width of the column of scores for dirs, as described in
+// Config.ScoreWidth.
+func (w *widget) scoreWidth(dirs []store.Dir) int {
+	switch {
+	case w.ScoreWidth > 0:
+		return w.ScoreWidth
+	case w.ScoreWidth < 0:
+		return maxScoreWidth(dirs, w.list.pinnedMarker)
+	}
+	return defaultScoreWidth
+}
+
+// Filters the directories with the query p and shows them in cb, which is the
+// ComboBox of the widget; it is passed because the ComboBox filters once while
+// being created.
+func (w *widget) filterDirs(cb cli.ComboBox, p string) {
+	if w.RememberFilter {
+		setLastFilter(p)
+	}
+	l, _ := w.getState()
+	selected := 0
+	if l.loading {
+		// Don't select the placeholder.
+		selected = -1
+	}
+	l = l.filterQuery(p, w.Config)
+	if p == "" && w.SuppressRecent > 0 {
+		l = l.without(getRecentlyAccepted(w.SuppressRecent))
+	}
+	if !l.loading && p != "" && len(l.dirs) == 0 {
+		// Don't select the note.
+		l.noMatches, selected = true, -1
+		if w.OnEmpty != nil {
+			w.OnEmpty(p)
+		}
+	}
+	if l.byPath {
+		l = l.sortByPath()
+	} else if w.SmartRank {
+		l = l.smartRank(p)
+	}
+	l = l.truncate(w.MaxEntries)
+	if w.ColorByScore && !w.NoColor {
+		l.colorByScore, l.maxScore = true, maxFiniteScore(l.dirs)
+	}
+	if w.GroupByParent || (w.SplitFrequentRecent && !l.byPath) {
+		if w.GroupByParent {
+			l = l.groupByParent()
+		} else {
+			l = l.splitFrequentRecent(w.Now())
+		}
+		w.mutex.Lock()
+		w.lastSelected = -1
+		w.mutex.Unlock()
+	}
+	cb.ListBox().Reset(l, selected)
+}
+
+// Like filterDirs, but waits for Config.FilterDebounce before filtering,
+// dropping the pending filtering if the query changes in the meantime.
+func (w *widget) debounceFilter(cb cli.ComboBox, p string) {
+	w.debounceMutex.Lock()
+	defer w.debounceMutex.Unlock()
+	if w.stopPending != nil {
+		w.stopPending()
+		w.stopPending = nil
+	}
+	if p == w.filteredQuery {
+		// Refiltering with the same query, for example after the
+		// directories are loaded; don't delay it.
+		cli.CatchPanic(w.app, func() { w.filterDirs(cb, p) })
+		return
+	}
+	w.stopPending = afterFunc(w.FilterDebounce, func() {
+		w.debounceMutex.Lock()
+		w.filteredQuery, w.stopPending = p, nil
+		w.debounceMutex.Unlock()
+		cli.CatchPanic(w.app, func() { w.filterDirs(cb, p) })
+		w.app.Redraw()
+	})
+}
+
+// Loads the directories, returning whether the addon is still open.
+func (w *widget) load() bool {
+	var dirs []store.Dir
+	var loadedWs workspace
+	var err error
+	ok := cli.CatchPanic(w.app, func() { dirs, loadedWs, err = rankings(w.ctx, w.Config) })
+	if w.ctx.Err() != nil || !w.shown() {
+		// Closed while loading; don't touch the app any more.
+		return false
+	}
+	if !ok {
+		w.closeAddon()
+		return false
+	}
+	if err != nil {
+		w.app.Notify(w.ErrorPrefix + err.Error())
+		if len(dirs) == 0 {
+			w.closeAddon()
+			return false
+		}
+	}
+	scoreWidth := w.scoreWidth(dirs)
+	visitTimes, times, timeWidth := w.loadTimes(dirs)
+	w.mutex.Lock()
+	w.list.dirs, w.list.loading, w.list.scoreWidth, w.ws = dirs, false, scoreWidth, loadedWs
+	w.list.times, w.list.timeWidth, w.list.visitTimes = times, timeWidth, visitTimes
+	w.mutex.Unlock()
+	w.Refilter()
+	w.app.Redraw()
+	return true
+}
+
+// Loads the visit times of dirs, and formats them if Config.ShowTime is set.
+// Since this calls user-supplied callbacks, a panic is shown as a note and
+// the times loaded so far are dropped.
+func (w *widget) loadTimes(dirs []store.Dir) (map[string]time.Time, map[string]string, int) {
+	var visitTimes map[string]time.Time
+	times := map[string]string{}
+	timeWidth := 0
+	ok := cli.CatchPanic(w.app, func() {
+		if w.ShowTime || w.SplitFrequentRecent {
+			if ts, ok := w.Store.(TimeStore); ok {
+				var err error
+				visitTimes, err = ts.VisitTimes()
+				if err != nil {
+					w.app.Notify(w.ErrorPrefix + err.Error())
+				}
+			}
+		}
+		if !w.ShowTime {
+			return
+		}
+		format := w.FormatTime
+		if format == nil {
+			now := w.Now()
+			format = func(t time.Time) string { return formatRelativeTime(t, now) }
+		}
+		for _, dir := range dirs {
+			if t, ok := visitTimes[dir.Path]; ok && !t.IsZero() {
+				s := format(t)
+				times[dir.Path] = s
+				if width := wcwidth.Of(s); width > timeWidth {
+					timeWidth = width
+				}
+			}
+		}
+	})
+	if !ok {
+		return nil, map[string]string{}, 0
+	}
+	return visitTimes, times, timeWidth
+}
+
+// Loads the directories, selects Config.InitialPath, and loads them again
+// whenever Config.Watch fires, until the addon is closed.
+func (w *widget) loadAndWatch() {
+	defer w.cancel()
+	if !w.load() {
+		return
+	}
+	if w.InitialPath != "" {
+		w.selectPath(w.InitialPath)
+		w.app.Redraw()
+	}
+	if w.Watch == nil {
+		return
+	}
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case _, ok := <-w.Watch:
+			if !ok {
+				return
+			}
+		}
+		if !w.shown() {
+			return
+		}
+		selected, hasSelected := "", false
+		w.withSelected(func(path string) { selected, hasSelected = path, true })
+		if !w.load() {
+			return
+		}
+		if hasSelected {
+			w.selectPath(selected)
+		}
+		w.app.Redraw()
+	}
+}
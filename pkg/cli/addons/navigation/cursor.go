@@ -24,6 +24,14 @@ type Cursor interface {
 	Descend(name string) error
 }
 
+// PathCursor is a Cursor that can also return the path of the current
+// directory, which Remember needs.
+type PathCursor interface {
+	Cursor
+	// CurrentPath returns the path of the current directory.
+	CurrentPath() (string, error)
+}
+
 // File represents a potentially virtual file.
 type File interface {
 	// Name returns the name of the file.
@@ -52,6 +60,8 @@ func (c osCursor) Current() (File, error) {
 	return file{filepath.Base(abs), abs, os.ModeDir, c.colorist}, nil
 }
 
+func (c osCursor) CurrentPath() (string, error) { return filepath.Abs(".") }
+
 func (c osCursor) Parent() (File, error) {
 	if abs, _ := filepath.Abs("."); abs == "/" {
 		return emptyDir{}, nil
@@ -28,6 +28,13 @@ func (c *testCursor) Current() (File, error) {
 	return getDirFile(c.root, c.pwd)
 }
 
+func (c *testCursor) CurrentPath() (string, error) {
+	if c.currentErr != nil {
+		return "", c.currentErr
+	}
+	return "/" + strings.Join(c.pwd, "/"), nil
+}
+
 func (c *testCursor) Parent() (File, error) {
 	if c.parentErr != nil {
 		return nil, c.parentErr
@@ -2,6 +2,7 @@
 package navigation
 
 import (
+	"errors"
 	"sort"
 	"strings"
 	"sync"
@@ -21,6 +22,10 @@ type Config struct {
 	// A function that returns the relative weights of the widths of the 3
 	// columns. If unspecified, the ratio is 1:3:4.
 	WidthRatio func() [3]int
+	// Remember is called with the path of the current directory by Remember,
+	// typically to bump its score in the directory history. If nil, Remember
+	// does nothing. The Cursor must implement PathCursor for Remember to work.
+	Remember func(path string) error
 }
 
 type state struct {
@@ -378,6 +383,30 @@ func MutateShowHidden(app cli.App, f func(bool) bool) {
 	})
 }
 
+var errNoCurrentPath = errors.New("cursor doesn't support getting the current path")
+
+// Remember calls Config.Remember with the path of the current directory if
+// the navigation addon is active. Errors are shown as notes.
+func Remember(app cli.App) {
+	actOnWidget(app, func(w *widget) {
+		if w.Remember == nil {
+			return
+		}
+		pc, ok := w.Cursor.(PathCursor)
+		if !ok {
+			app.Notify(errNoCurrentPath.Error())
+			return
+		}
+		path, err := pc.CurrentPath()
+		if err == nil {
+			err = w.Remember(path)
+		}
+		if err != nil {
+			app.Notify(err.Error())
+		}
+	})
+}
+
 func actOnWidget(app cli.App, f func(*widget)) {
 	w, ok := app.CopyState().Addon.(*widget)
 	if ok {
@@ -143,6 +143,67 @@ func TestGetSelectedName(t *testing.T) {
 	}
 }
 
+func TestRemember(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	rememberCh := make(chan string, 10)
+	c := getTestCursor()
+	Start(f.App, Config{
+		Cursor: c,
+		Remember: func(path string) error {
+			rememberCh <- path
+			if path == "/d/d2" {
+				return errors.New("cannot remember")
+			}
+			return nil
+		},
+	})
+
+	Remember(f.App)
+	if got, want := <-rememberCh, "/d"; got != want {
+		t.Errorf("Remember called with %q, want %q", got, want)
+	}
+
+	// Descend into d2.
+	Select(f.App, cli.Next)
+	Descend(f.App)
+	Remember(f.App)
+	if got, want := <-rememberCh, "/d/d2"; got != want {
+		t.Errorf("Remember called with %q, want %q", got, want)
+	}
+	f.TestTTYNotes(t, "cannot remember")
+}
+
+func TestRemember_NoCurrentPath(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	remembered := false
+	// Hide CurrentPath of the test cursor.
+	c := struct{ Cursor }{getTestCursor()}
+	Start(f.App, Config{
+		Cursor:   c,
+		Remember: func(string) error { remembered = true; return nil },
+	})
+
+	Remember(f.App)
+	f.TestTTYNotes(t, errNoCurrentPath.Error())
+	if remembered {
+		t.Errorf("Remember called without a PathCursor")
+	}
+}
+
+func TestRemember_Nil(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	// Neither of these should panic.
+	Remember(f.App)
+	Start(f.App, Config{Cursor: getTestCursor()})
+	Remember(f.App)
+}
+
 func TestNavigation_FakeFS(t *testing.T) {
 	cursor := getTestCursor()
 	testNavigation(t, cursor)
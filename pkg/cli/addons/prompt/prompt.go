@@ -0,0 +1,55 @@
+// Package prompt implements an addon that prompts the user for a single line of
+// input, validating it before accepting it.
+package prompt
+
+import (
+	"github.com/elves/elvish/pkg/cli"
+	"github.com/elves/elvish/pkg/ui"
+)
+
+// Config is the configuration to start the prompt addon.
+type Config struct {
+	// Binding is the key binding.
+	Binding cli.Handler
+	// Prompt is shown before the input.
+	Prompt string
+	// Validate is called with the input when Enter is pressed. If it returns
+	// an error, the error is shown as a note and the addon stays open. If nil,
+	// any input is valid.
+	Validate func(string) error
+	// Accept is called with the input after it has been validated and the
+	// addon has been closed.
+	Accept func(string)
+}
+
+// Start starts the prompt addon.
+func Start(app cli.App, cfg Config) {
+	if cfg.Binding == nil {
+		cfg.Binding = cli.DummyHandler{}
+	}
+	prompt := ui.T(cfg.Prompt)
+	var w cli.CodeArea
+	w = cli.NewCodeArea(cli.CodeAreaSpec{
+		OverlayHandler: cfg.Binding,
+		Prompt:         func() ui.Text { return prompt },
+		OnSubmit: func() {
+			input := w.CopyState().Buffer.Content
+			if cfg.Validate != nil {
+				if err := cfg.Validate(input); err != nil {
+					app.Notify(err.Error())
+					return
+				}
+			}
+			app.MutateState(func(s *cli.State) {
+				if s.Addon == w {
+					s.Addon = nil
+				}
+			})
+			if cfg.Accept != nil {
+				cfg.Accept(input)
+			}
+		},
+	})
+	app.MutateState(func(s *cli.State) { s.Addon = w })
+	app.Redraw()
+}
@@ -0,0 +1,65 @@
+package prompt
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/elves/elvish/pkg/cli"
+	. "github.com/elves/elvish/pkg/cli/clitest"
+	"github.com/elves/elvish/pkg/cli/term"
+	"github.com/elves/elvish/pkg/ui"
+)
+
+func TestPrompt_Rendering(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	Start(f.App, Config{Prompt: "name: "})
+	f.TTY.Inject(term.K('a'))
+	f.TestTTY(t, "\n", "name: a", term.DotHere)
+}
+
+func TestPrompt_ValidationLoop(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	acceptCh := make(chan string, 1)
+	Start(f.App, Config{
+		Prompt: "name: ",
+		Validate: func(s string) error {
+			if s == "" {
+				return errors.New("name is empty")
+			}
+			return nil
+		},
+		Accept: func(s string) { acceptCh <- s },
+	})
+
+	// Invalid input: the error is shown and the prompt stays open.
+	f.TTY.Inject(term.K(ui.Enter))
+	f.TestTTYNotes(t, "name is empty")
+	f.TestTTY(t, "\n", "name: ", term.DotHere)
+
+	// Valid input: Accept is called and the prompt is closed.
+	f.TTY.Inject(term.K('a'), term.K(ui.Enter))
+	if got := <-acceptCh; got != "a" {
+		t.Errorf("Accept called with %q, want %q", got, "a")
+	}
+	f.TestTTY(t /* nothing */)
+	if addon := cli.Addon(f.App); addon != nil {
+		t.Errorf("addon is %v, want nil", addon)
+	}
+}
+
+func TestPrompt_Binding(t *testing.T) {
+	f := Setup()
+	defer f.Stop()
+
+	bindingCalled := make(chan bool, 1)
+	Start(f.App, Config{
+		Binding: cli.MapHandler{term.K('a'): func() { bindingCalled <- true }},
+	})
+	f.TTY.Inject(term.K('a'))
+	<-bindingCalled
+	f.TestTTY(t, "\n", term.DotHere)
+}
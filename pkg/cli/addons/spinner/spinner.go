@@ -0,0 +1,116 @@
+// Package spinner implements the spinner addon, which shows an animated busy
+// indicator in the modeline while a long operation runs.
+package spinner
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elves/elvish/pkg/cli"
+	"github.com/elves/elvish/pkg/cli/term"
+	"github.com/elves/elvish/pkg/ui"
+)
+
+// Config keeps the configuration for the spinner addon.
+type Config struct {
+	// Name to show in the modeline before the frame. If empty, only the frame
+	// is shown.
+	Name string
+	// Frames of the animation. If empty, DefaultFrames is used.
+	Frames []string
+	// Interval between two frames. If zero or negative, DefaultInterval is
+	// used.
+	Interval time.Duration
+}
+
+// DefaultFrames is the default frame sequence of the spinner.
+var DefaultFrames = []string{"|", "/", "-", "\\"}
+
+// DefaultInterval is the default interval between two frames.
+const DefaultInterval = 100 * time.Millisecond
+
+// Creates a ticker. It returns the channel of ticks and a function to stop the
+// ticker. Overridden in tests.
+var newTicker = func(d time.Duration) (<-chan time.Time, func()) {
+	t := time.NewTicker(d)
+	return t.C, t.Stop
+}
+
+type widget struct {
+	Config
+	app cli.App
+	// Protects frame.
+	mutex sync.Mutex
+	frame int
+}
+
+func (w *widget) Render(width, height int) *term.Buffer {
+	w.mutex.Lock()
+	frame := w.Frames[w.frame]
+	w.mutex.Unlock()
+
+	bb := term.NewBufferBuilder(width)
+	if w.Name != "" {
+		bb.WriteStyled(cli.ModeLine(w.Name, true))
+	}
+	buf := bb.WriteStyled(ui.T(frame)).Buffer()
+	buf.TrimToLines(0, height)
+	return buf
+}
+
+// Handle passes the event to the codearea, so that the user can keep typing
+// while the spinner is shown.
+func (w *widget) Handle(event term.Event) bool {
+	return w.app.CodeArea().Handle(event)
+}
+
+func (w *widget) Focus() bool { return false }
+
+func (w *widget) next() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.frame = (w.frame + 1) % len(w.Frames)
+}
+
+// Start starts the spinner addon and returns a function for stopping it. The
+// stop function removes the spinner if it is still shown, and is safe to call
+// more than once.
+func Start(app cli.App, cfg Config) (stop func()) {
+	if len(cfg.Frames) == 0 {
+		cfg.Frames = DefaultFrames
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	w := &widget{Config: cfg, app: app}
+	app.MutateState(func(s *cli.State) { s.Addon = w })
+	app.Redraw()
+
+	ticks, stopTicker := newTicker(cfg.Interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticks:
+				w.next()
+				app.Redraw()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			stopTicker()
+			close(done)
+			app.MutateState(func(s *cli.State) {
+				if s.Addon == w {
+					s.Addon = nil
+				}
+			})
+			app.Redraw()
+		})
+	}
+}
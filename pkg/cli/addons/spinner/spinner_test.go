@@ -0,0 +1,122 @@
+package spinner
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/elves/elvish/pkg/cli/clitest"
+	"github.com/elves/elvish/pkg/cli/term"
+)
+
+func setupTicker() (chan<- time.Time, func()) {
+	ticks := make(chan time.Time)
+	saved := newTicker
+	newTicker = func(time.Duration) (<-chan time.Time, func()) {
+		return ticks, func() {}
+	}
+	return ticks, func() { newTicker = saved }
+}
+
+func TestSpinner(t *testing.T) {
+	ticks, restore := setupTicker()
+	defer restore()
+	f := Setup()
+	defer f.Stop()
+
+	stop := Start(f.App, Config{Frames: []string{"a", "b"}})
+	f.TestTTY(t, "", term.DotHere, "\na")
+
+	ticks <- time.Time{}
+	f.TestTTY(t, "", term.DotHere, "\nb")
+
+	// Frames wrap around.
+	ticks <- time.Time{}
+	f.TestTTY(t, "", term.DotHere, "\na")
+
+	stop()
+	f.TestTTY(t, "", term.DotHere)
+	// Calling stop again is harmless.
+	stop()
+}
+
+func TestSpinner_Name(t *testing.T) {
+	_, restore := setupTicker()
+	defer restore()
+	f := Setup()
+	defer f.Stop()
+
+	stop := Start(f.App, Config{Name: " BUSY ", Frames: []string{"a"}})
+	defer stop()
+	f.TestTTY(t,
+		"", term.DotHere, "\n",
+		" BUSY ", Styles,
+		"******",
+		" a")
+}
+
+func TestSpinner_DefaultFrames(t *testing.T) {
+	_, restore := setupTicker()
+	defer restore()
+	f := Setup()
+	defer f.Stop()
+
+	stop := Start(f.App, Config{})
+	defer stop()
+	f.TestTTY(t, "", term.DotHere, "\n"+DefaultFrames[0])
+}
+
+func TestSpinner_PassesEventsToCodeArea(t *testing.T) {
+	_, restore := setupTicker()
+	defer restore()
+	f := Setup()
+	defer f.Stop()
+
+	stop := Start(f.App, Config{Frames: []string{"a"}})
+	defer stop()
+	f.TTY.Inject(term.K('x'))
+	f.TestTTY(t, "x", term.DotHere, "\na")
+}
+
+func TestSpinner_StopKeepsOtherAddon(t *testing.T) {
+	_, restore := setupTicker()
+	defer restore()
+	f := Setup()
+	defer f.Stop()
+
+	stop := Start(f.App, Config{Frames: []string{"a"}})
+	stop2 := Start(f.App, Config{Frames: []string{"b"}})
+	defer stop2()
+	stop()
+	f.TestTTY(t, "", term.DotHere, "\nb")
+}
+
+func TestSpinner_Interval(t *testing.T) {
+	saved := newTicker
+	defer func() { newTicker = saved }()
+	var got time.Duration
+	newTicker = func(d time.Duration) (<-chan time.Time, func()) {
+		got = d
+		return nil, func() {}
+	}
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		want     time.Duration
+	}{
+		{"zero", 0, DefaultInterval},
+		{"negative", -time.Second, DefaultInterval},
+		{"positive", 50 * time.Millisecond, 50 * time.Millisecond},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := Setup()
+			defer f.Stop()
+			stop := Start(f.App, Config{Interval: test.interval})
+			stop()
+			if got != test.want {
+				t.Errorf("ticker interval %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -216,6 +216,26 @@ func (t TTYCtrl) TestBuffer(tt *testing.T, b *term.Buffer) {
 	}
 }
 
+// TestPlainBuffer is like TestBuffer, but only compares the content of the
+// buffers without styles, as returned by (*term.Buffer).PlainString.
+func (t TTYCtrl) TestPlainBuffer(tt *testing.T, want string) {
+	tt.Helper()
+	timeout := time.After(testutil.ScaledMs(100))
+	for {
+		select {
+		case buf := <-t.bufCh:
+			if buf.PlainString() == want {
+				return
+			}
+		case <-timeout:
+			tt.Errorf("Wanted buffer not shown")
+			tt.Logf("Want:\n%s", want)
+			tt.Logf("Last buffer:\n%s", t.LastBuffer().PlainString())
+			return
+		}
+	}
+}
+
 // TestNotesBuffer verifies that a notes buffer will appear within the timeout of 4
 // seconds, and fails the test if it doesn't
 func (t TTYCtrl) TestNotesBuffer(tt *testing.T, b *term.Buffer) {
@@ -7,6 +7,7 @@ import (
 
 	"github.com/elves/elvish/pkg/cli"
 	"github.com/elves/elvish/pkg/cli/term"
+	"github.com/elves/elvish/pkg/ui"
 )
 
 func TestFakeTTY_Setup(t *testing.T) {
@@ -119,6 +120,14 @@ func TestFakeTTY_Buffer(t *testing.T) {
 	}
 }
 
+func TestFakeTTY_PlainBuffer(t *testing.T) {
+	tty, ttyCtrl := NewFakeTTY()
+	tty.UpdateBuffer(nil, term.NewBufferBuilder(10).Write("buf 1").Buffer(), true)
+	tty.UpdateBuffer(nil, term.NewBufferBuilder(10).
+		Write("buf ").Write("2", ui.Bold).Newline().Write("line 2").Buffer(), true)
+	ttyCtrl.TestPlainBuffer(t, "buf 2\nline 2")
+}
+
 func TestGetTTYCtrl(t *testing.T) {
 	fakeTTY, ttyCtrl := NewFakeTTY()
 	if got, ok := GetTTYCtrl(fakeTTY); got != ttyCtrl || !ok {
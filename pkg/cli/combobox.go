@@ -2,6 +2,7 @@ package cli
 
 import (
 	"github.com/elves/elvish/pkg/cli/term"
+	"github.com/elves/elvish/pkg/ui"
 )
 
 // ComboBox is a Widget that combines a ListBox and a CodeArea.
@@ -20,15 +21,25 @@ type ComboBoxSpec struct {
 	CodeArea CodeAreaSpec
 	ListBox  ListBoxSpec
 	OnFilter func(ComboBox, string)
+	// If true, the combobox starts in a normal mode in which events are not
+	// passed to the codearea, and j and k move the selection down and up,
+	// wrapping around if ListBox.Wrap is true. In
+	// the normal mode, / switches to a filtering mode, where events are
+	// handled as usual, and Escape switches back.
+	ViKeys bool
 }
 
 type comboBox struct {
 	codeArea CodeArea
 	listBox  ListBox
 	OnFilter func(ComboBox, string)
+	viKeys   bool
+	wrap     bool
 
 	// Last filter value.
 	lastFilter string
+	// Whether in the filtering mode when viKeys is true.
+	filtering bool
 }
 
 // NewComboBox creates a new ComboBox from the given spec.
@@ -40,8 +51,12 @@ func NewComboBox(spec ComboBoxSpec) ComboBox {
 		codeArea: NewCodeArea(spec.CodeArea),
 		listBox:  NewListBox(spec.ListBox),
 		OnFilter: spec.OnFilter,
+		viKeys:   spec.ViKeys,
+		wrap:     spec.ListBox.Wrap,
+		// The initial content of the codearea is used as the initial filter.
+		lastFilter: spec.CodeArea.State.Buffer.Content,
 	}
-	w.OnFilter(w, "")
+	w.OnFilter(w, w.lastFilter)
 	return w
 }
 
@@ -55,8 +70,19 @@ func (w *comboBox) Render(width, height int) *term.Buffer {
 
 // Handle first lets the listbox handle the event, and if it is unhandled, lets
 // the codearea handle it. If the codearea has handled the event and the code
-// content has changed, it calls OnFilter with the new content.
+// content has changed, it calls OnFilter with the new content. When ViKeys is
+// true, the event is handled according to the mode instead, as described in
+// ComboBoxSpec.
 func (w *comboBox) Handle(event term.Event) bool {
+	if w.viKeys {
+		if !w.filtering {
+			return w.handleNormal(event)
+		}
+		if event == term.K('[', ui.Ctrl) {
+			w.filtering = false
+			return true
+		}
+	}
 	if w.listBox.Handle(event) {
 		return true
 	}
@@ -71,6 +97,33 @@ func (w *comboBox) Handle(event term.Event) bool {
 	return false
 }
 
+// Handles an event in the normal mode when ViKeys is true.
+func (w *comboBox) handleNormal(event term.Event) bool {
+	if w.listBox.Handle(event) {
+		return true
+	}
+	switch event {
+	case term.K('j'):
+		if w.wrap {
+			w.listBox.Select(NextWrap)
+		} else {
+			w.listBox.Select(Next)
+		}
+		return true
+	case term.K('k'):
+		if w.wrap {
+			w.listBox.Select(PrevWrap)
+		} else {
+			w.listBox.Select(Prev)
+		}
+		return true
+	case term.K('/'):
+		w.filtering = true
+		return true
+	}
+	return false
+}
+
 func (w *comboBox) Refilter() {
 	w.OnFilter(w, w.codeArea.CopyState().Buffer.Content)
 }
@@ -44,6 +44,23 @@ func TestComboBox_Render(t *testing.T) {
 	TestRender(t, comboBoxRenderTests)
 }
 
+func TestComboBox_InitialFilter(t *testing.T) {
+	var lastFilter string
+	w := NewComboBox(ComboBoxSpec{
+		CodeArea: CodeAreaSpec{
+			State: CodeAreaState{Buffer: CodeBuffer{Content: "x", Dot: 1}}},
+		OnFilter: func(w ComboBox, filter string) { lastFilter = filter }})
+	if lastFilter != "x" {
+		t.Errorf("OnFilter called with %q initially, want %q", lastFilter, "x")
+	}
+
+	lastFilter = ""
+	w.Handle(term.K(ui.Left))
+	if lastFilter != "" {
+		t.Errorf("OnFilter called with %q after moving dot", lastFilter)
+	}
+}
+
 func TestComboBox_Handle(t *testing.T) {
 	var onFilterCalled bool
 	var lastFilter string
@@ -90,6 +107,58 @@ func TestComboBox_Handle(t *testing.T) {
 	}
 }
 
+func TestComboBox_Handle_ViKeys(t *testing.T) {
+	var lastFilter string
+	w := NewComboBox(ComboBoxSpec{
+		OnFilter: func(w ComboBox, filter string) { lastFilter = filter },
+		ListBox: ListBoxSpec{
+			State: ListBoxState{Items: TestItems{NItems: 3}}},
+		ViKeys: true})
+
+	testSelected := func(want int) {
+		t.Helper()
+		if selected := w.ListBox().CopyState().Selected; selected != want {
+			t.Errorf("selected %v, want %v", selected, want)
+		}
+	}
+	testFilter := func(want string) {
+		t.Helper()
+		if content := w.CodeArea().CopyState().Buffer.Content; content != want {
+			t.Errorf("codearea content %q, want %q", content, want)
+		}
+		if lastFilter != want {
+			t.Errorf("OnFilter called with %q, want %q", lastFilter, want)
+		}
+	}
+
+	// In the normal mode, j and k move the selection, and other keys don't
+	// go to the codearea.
+	w.Handle(term.K('j'))
+	w.Handle(term.K('j'))
+	testSelected(2)
+	w.Handle(term.K('k'))
+	testSelected(1)
+	if handled := w.Handle(term.K('a')); handled {
+		t.Errorf("letter key handled in the normal mode")
+	}
+	testFilter("")
+	// The listbox still handles keys.
+	w.Handle(term.K(ui.Down))
+	testSelected(2)
+
+	// / switches to the filtering mode, in which j and k go to the codearea.
+	w.Handle(term.K('/'))
+	w.Handle(term.K('j'))
+	w.Handle(term.K('k'))
+	testFilter("jk")
+
+	// Escape switches back to the normal mode, keeping the filter.
+	w.Handle(term.K('[', ui.Ctrl))
+	w.Handle(term.K('k'))
+	testSelected(1)
+	testFilter("jk")
+}
+
 func TestRefilter(t *testing.T) {
 	onFilter := make(chan string, 100)
 	w := NewComboBox(ComboBoxSpec{
@@ -1,11 +1,13 @@
 package cli
 
 import (
+	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/elves/elvish/pkg/cli/term"
 	"github.com/elves/elvish/pkg/ui"
+	"github.com/elves/elvish/pkg/wcwidth"
 )
 
 // ListBox is a list for displaying and selecting from a list of items.
@@ -45,6 +47,20 @@ type ListBoxSpec struct {
 	// first segment of the item, and the right spacing and padding will be
 	// styled the same as the last segment of the item.
 	ExtendStyle bool
+	// If true, Up on the first item selects the last item, and Down on the
+	// last item selects the first item.
+	Wrap bool
+	// The styling applied to the selected item. If nil, the item is shown in
+	// inverse video.
+	SelectedStyling ui.Styling
+	// If true, Ctrl-U and Ctrl-D move the selection by a page like PageUp and
+	// PageDown in the vertical layout. This is off by default, since in a
+	// ComboBox it takes those keys away from the CodeArea.
+	CtrlPageKeys bool
+	// If true, the vertical layout shows the position of the selected item
+	// and the number of items, like "3/10", on its last line along with the
+	// scrollbar when not all items fit.
+	ShowScrollbar bool
 
 	// State. When used in New, this field specifies the initial state.
 	State ListBoxState
@@ -73,11 +89,12 @@ func NewListBox(spec ListBoxSpec) ListBox {
 			spec.OnSelect(s.Items, s.Selected)
 		}
 	}
+	if spec.SelectedStyling == nil {
+		spec.SelectedStyling = ui.Inverse
+	}
 	return &listBox{ListBoxSpec: spec}
 }
 
-var stylingForSelected = ui.Inverse
-
 func (w *listBox) Render(width, height int) *term.Buffer {
 	if w.Horizontal {
 		return w.renderHorizontal(width, height)
@@ -134,7 +151,8 @@ func (w *listBox) renderHorizontal(width, height int) *term.Buffer {
 		colBuf := croppedLines{
 			lines: col, padding: w.Padding,
 			selectFrom: selectedRow, selectTo: selectedRow + 1,
-			extendStyle: w.ExtendStyle}.Render(colWidth, height)
+			extendStyle: w.ExtendStyle, selectedStyling: w.SelectedStyling,
+		}.Render(colWidth, height)
 		buf.ExtendRight(colBuf)
 
 		remainedWidth -= colWidth
@@ -154,6 +172,18 @@ func (w *listBox) renderHorizontal(width, height int) *term.Buffer {
 }
 
 func (w *listBox) renderVertical(width, height int) *term.Buffer {
+	buf, state, scrolled := w.renderVerticalWindow(width, height)
+	if w.ShowScrollbar && scrolled && height > 1 {
+		// Not all items fit; render again, leaving room for the position.
+		buf, state, _ = w.renderVerticalWindow(width, height-1)
+		buf.Extend(renderPosition(state.Selected, state.Items.Len(), width), false)
+	}
+	return buf
+}
+
+// Renders the window of items that fits in the given height, returning the
+// buffer, the state used and whether not all items fit.
+func (w *listBox) renderVerticalWindow(width, height int) (*term.Buffer, ListBoxState, bool) {
 	var state ListBoxState
 	var firstCrop int
 	w.mutate(func(s *ListBoxState) {
@@ -167,7 +197,7 @@ func (w *listBox) renderVertical(width, height int) *term.Buffer {
 	})
 
 	if state.Items == nil || state.Items.Len() == 0 {
-		return Label{Content: w.Placeholder}.Render(width, height)
+		return Label{Content: w.Placeholder}.Render(width, height), state, false
 	}
 
 	items, selected, first := state.Items, state.Selected, state.First
@@ -177,7 +207,12 @@ func (w *listBox) renderVertical(width, height int) *term.Buffer {
 
 	var i, selectFrom, selectTo int
 	for i = first; i < n && len(allLines) < height; i++ {
-		item := items.Show(i)
+		var item ui.Text
+		if widthItems, ok := items.(WidthItems); ok {
+			item = widthItems.ShowWidth(i, width-2*w.Padding)
+		} else {
+			item = items.Show(i)
+		}
 		lines := item.SplitByRune('\n')
 		if i == first {
 			lines = lines[firstCrop:]
@@ -197,14 +232,31 @@ func (w *listBox) renderVertical(width, height int) *term.Buffer {
 
 	var rd Renderer = croppedLines{
 		lines: allLines, padding: w.Padding,
-		selectFrom: selectFrom, selectTo: selectTo, extendStyle: w.ExtendStyle}
-	if first > 0 || i < n || hasCropped {
+		selectFrom: selectFrom, selectTo: selectTo, extendStyle: w.ExtendStyle,
+		selectedStyling: w.SelectedStyling}
+	scrolled := first > 0 || i < n || hasCropped
+	if scrolled {
 		rd = VScrollbarContainer{
 			Content:   rd,
 			Scrollbar: VScrollbar{Total: n, Low: first, High: i},
 		}
 	}
-	return rd.Render(width, height)
+	return rd.Render(width, height), state, scrolled
+}
+
+// Renders the position of the selected item among n items, aligned to the
+// right.
+func renderPosition(selected, n, width int) *term.Buffer {
+	pos := "-"
+	if 0 <= selected && selected < n {
+		pos = strconv.Itoa(selected + 1)
+	}
+	s := pos + "/" + strconv.Itoa(n)
+	if pad := width - wcwidth.Of(s); pad > 0 {
+		s = strings.Repeat(" ", pad) + s
+	}
+	return term.NewBufferBuilder(width).
+		WriteStyled(ui.T(s, ui.FgMagenta).TrimWcwidth(width)).Buffer()
 }
 
 type croppedLines struct {
@@ -213,6 +265,8 @@ type croppedLines struct {
 	selectFrom  int
 	selectTo    int
 	extendStyle bool
+	// Applied to the selected lines.
+	selectedStyling ui.Styling
 }
 
 func (c croppedLines) Render(width, height int) *term.Buffer {
@@ -240,7 +294,7 @@ func (c croppedLines) Render(width, height int) *term.Buffer {
 			acc = ui.Concat(acc, right).TrimWcwidth(width)
 		}
 		if selected {
-			acc = ui.StyleText(acc, stylingForSelected)
+			acc = ui.StyleText(acc, c.selectedStyling)
 		}
 
 		bb.WriteStyled(acc)
@@ -255,11 +309,27 @@ func (w *listBox) Handle(event term.Event) bool {
 
 	switch event {
 	case term.K(ui.Up):
-		w.Select(Prev)
+		if w.Wrap {
+			w.Select(PrevWrap)
+		} else {
+			w.Select(Prev)
+		}
 		return true
 	case term.K(ui.Down):
-		w.Select(Next)
+		if w.Wrap {
+			w.Select(NextWrap)
+		} else {
+			w.Select(Next)
+		}
 		return true
+	case term.K(ui.PageUp):
+		return w.selectPage(PrevPage)
+	case term.K(ui.PageDown):
+		return w.selectPage(NextPage)
+	case term.K('U', ui.Ctrl):
+		return w.CtrlPageKeys && w.selectPage(PrevPage)
+	case term.K('D', ui.Ctrl):
+		return w.CtrlPageKeys && w.selectPage(NextPage)
 	case term.K(ui.Enter):
 		w.Accept()
 		return true
@@ -267,6 +337,17 @@ func (w *listBox) Handle(event term.Event) bool {
 	return false
 }
 
+// Moves the selection with f, which moves it by a page, and returns true. Pages
+// are only supported in the vertical layout; in the horizontal layout, it
+// returns false without moving the selection.
+func (w *listBox) selectPage(f func(ListBoxState) int) bool {
+	if w.Horizontal {
+		return false
+	}
+	w.Select(f)
+	return true
+}
+
 func (w *listBox) CopyState() ListBoxState {
 	w.StateMutex.RLock()
 	defer w.StateMutex.RUnlock()
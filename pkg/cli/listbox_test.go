@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/elves/elvish/pkg/cli/term"
@@ -30,6 +31,16 @@ var listBoxRenderVerticalTests = []RenderTest{
 			Write("item 0    ", ui.Inverse).
 			Newline().Write("item 1"),
 	},
+	{
+		Name: "custom styling for selected item",
+		Given: NewListBox(ListBoxSpec{
+			SelectedStyling: ui.Stylings(ui.Bold, ui.FgGreen),
+			State:           ListBoxState{Items: TestItems{NItems: 2}, Selected: 0}}),
+		Width: 10, Height: 3,
+		Want: bb(10).
+			Write("item 0    ", ui.Bold, ui.FgGreen).
+			Newline().Write("item 1"),
+	},
 	{
 		Name:  "long lines cropped",
 		Given: NewListBox(ListBoxSpec{State: ListBoxState{Items: TestItems{NItems: 2}, Selected: 0}}),
@@ -72,6 +83,39 @@ var listBoxRenderVerticalTests = []RenderTest{
 			Write("item     ", ui.Inverse).
 			Write(" ", ui.Inverse, ui.FgMagenta),
 	},
+	{
+		Name: "position with ShowScrollbar when not showing all items",
+		Given: NewListBox(ListBoxSpec{ShowScrollbar: true,
+			State: ListBoxState{Items: TestItems{NItems: 4}, Selected: 0}}),
+		Width: 10, Height: 3,
+		Want: bb(10).
+			Write("item 0   ", ui.Inverse).
+			Write(" ", ui.Inverse, ui.FgMagenta).
+			Newline().Write("item 1   ").
+			Write("│", ui.FgMagenta).
+			Newline().Write("       1/4", ui.FgMagenta),
+	},
+	{
+		Name: "position with ShowScrollbar following the selection",
+		Given: NewListBox(ListBoxSpec{ShowScrollbar: true,
+			State: ListBoxState{Items: TestItems{NItems: 4}, Selected: 3}}),
+		Width: 10, Height: 3,
+		Want: bb(10).
+			Write("item 2   ").
+			Write("│", ui.FgMagenta).
+			Newline().Write("item 3   ", ui.Inverse).
+			Write(" ", ui.Inverse, ui.FgMagenta).
+			Newline().Write("       4/4", ui.FgMagenta),
+	},
+	{
+		Name: "no position with ShowScrollbar when showing all items",
+		Given: NewListBox(ListBoxSpec{ShowScrollbar: true,
+			State: ListBoxState{Items: TestItems{NItems: 2}, Selected: 0}}),
+		Width: 10, Height: 3,
+		Want: bb(10).
+			Write("item 0    ", ui.Inverse).
+			Newline().Write("item 1"),
+	},
 	{
 		Name: "padding",
 		Given: NewListBox(
@@ -121,6 +165,26 @@ var listBoxRenderVerticalTests = []RenderTest{
 			Write(" x1   ", ui.FgBlue, ui.BgGreen).
 			Buffer(),
 	},
+	{
+		Name: "items implementing WidthItems",
+		Given: NewListBox(ListBoxSpec{
+			Padding: 1,
+			State:   ListBoxState{Items: widthItems{TestItems{NItems: 2}}}}),
+		Width: 6, Height: 2,
+
+		Want: bb(6).
+			Write(" w4   ", ui.Inverse).
+			Newline().
+			Write(" w4").
+			Buffer(),
+	},
+}
+
+// Implements WidthItems by showing the width.
+type widthItems struct{ TestItems }
+
+func (widthItems) ShowWidth(i, width int) ui.Text {
+	return ui.T(fmt.Sprintf("w%d", width))
 }
 
 func TestListBox_Render_Vertical(t *testing.T) {
@@ -297,6 +361,77 @@ var listBoxHandleTests = []HandleTest{
 
 		WantNewState: ListBoxState{Items: TestItems{NItems: 10}, Selected: 0},
 	},
+	{
+		Name:  "up wrapping to n-1 with Wrap",
+		Given: NewListBox(ListBoxSpec{Wrap: true, State: ListBoxState{Items: TestItems{NItems: 10}, Selected: 0}}),
+		Event: term.K(ui.Up),
+
+		WantNewState: ListBoxState{Items: TestItems{NItems: 10}, Selected: 9},
+	},
+	{
+		Name:  "down wrapping to 0 with Wrap",
+		Given: NewListBox(ListBoxSpec{Wrap: true, State: ListBoxState{Items: TestItems{NItems: 10}, Selected: 9}}),
+		Event: term.K(ui.Down),
+
+		WantNewState: ListBoxState{Items: TestItems{NItems: 10}, Selected: 0},
+	},
+	{
+		Name:  "page down moving selection down by a page",
+		Given: NewListBox(ListBoxSpec{State: ListBoxState{Items: TestItems{NItems: 10}, Selected: 1, Height: 3}}),
+		Event: term.K(ui.PageDown),
+
+		WantNewState: ListBoxState{Items: TestItems{NItems: 10}, Selected: 4, Height: 3},
+	},
+	{
+		Name:  "page down stopping at n-1",
+		Given: NewListBox(ListBoxSpec{State: ListBoxState{Items: TestItems{NItems: 10}, Selected: 8, Height: 3}}),
+		Event: term.K(ui.PageDown),
+
+		WantNewState: ListBoxState{Items: TestItems{NItems: 10}, Selected: 9, Height: 3},
+	},
+	{
+		Name:  "ctrl-d moving selection down by a page with CtrlPageKeys",
+		Given: NewListBox(ListBoxSpec{CtrlPageKeys: true, State: ListBoxState{Items: TestItems{NItems: 10}, Selected: 1, Height: 3}}),
+		Event: term.K('D', ui.Ctrl),
+
+		WantNewState: ListBoxState{Items: TestItems{NItems: 10}, Selected: 4, Height: 3},
+	},
+	{
+		Name:  "page up moving selection up by a page",
+		Given: NewListBox(ListBoxSpec{State: ListBoxState{Items: TestItems{NItems: 10}, Selected: 7, Height: 3}}),
+		Event: term.K(ui.PageUp),
+
+		WantNewState: ListBoxState{Items: TestItems{NItems: 10}, Selected: 4, Height: 3},
+	},
+	{
+		Name:  "page up stopping at 0",
+		Given: NewListBox(ListBoxSpec{State: ListBoxState{Items: TestItems{NItems: 10}, Selected: 1, Height: 3}}),
+		Event: term.K(ui.PageUp),
+
+		WantNewState: ListBoxState{Items: TestItems{NItems: 10}, Selected: 0, Height: 3},
+	},
+	{
+		Name:  "ctrl-u moving selection up by a page with CtrlPageKeys",
+		Given: NewListBox(ListBoxSpec{CtrlPageKeys: true, State: ListBoxState{Items: TestItems{NItems: 10}, Selected: 7, Height: 3}}),
+		Event: term.K('U', ui.Ctrl),
+
+		WantNewState: ListBoxState{Items: TestItems{NItems: 10}, Selected: 4, Height: 3},
+	},
+	{
+		Name:  "ctrl-d not handled without CtrlPageKeys",
+		Given: NewListBox(ListBoxSpec{State: ListBoxState{Items: TestItems{NItems: 10}, Selected: 1, Height: 3}}),
+		Event: term.K('D', ui.Ctrl),
+
+		WantUnhandled: true,
+	},
+	{
+		Name: "page down not handled in horizontal layout",
+		Given: NewListBox(ListBoxSpec{Horizontal: true,
+			State: ListBoxState{Items: TestItems{NItems: 10}, Selected: 1, Height: 3}}),
+		Event: term.K(ui.PageDown),
+
+		WantUnhandled: true,
+	},
 	{
 		Name:  "enter triggering default no-op accept",
 		Given: NewListBox(ListBoxSpec{State: ListBoxState{Items: TestItems{NItems: 10}, Selected: 5}}),
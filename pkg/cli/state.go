@@ -22,6 +22,16 @@ type Items interface {
 	Len() int
 }
 
+// WidthItems is an optional interface that Items may implement. When a
+// vertical listbox shows items that implement it, ShowWidth is called with the
+// width available to each item instead of Show.
+type WidthItems interface {
+	Items
+	// ShowWidth renders the item at the given zero-based index, given the
+	// width available to it.
+	ShowWidth(i, width int) ui.Text
+}
+
 // TestItems is an implementation of Items useful for testing.
 type TestItems struct {
 	Prefix string
@@ -143,6 +143,27 @@ func (b *Buffer) ExtendRight(b2 *Buffer) {
 // Buffer returns itself.
 func (b *Buffer) Buffer() *Buffer { return b }
 
+// PlainString returns the content of the buffer without styles, one line for
+// each line of the buffer, with trailing spaces removed. It is mainly useful
+// for comparing buffers in tests.
+func (b *Buffer) PlainString() string {
+	if b == nil {
+		return ""
+	}
+	sb := new(strings.Builder)
+	for i, line := range b.Lines {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+		var lineSb strings.Builder
+		for _, cell := range line {
+			lineSb.WriteString(cell.Text)
+		}
+		sb.WriteString(strings.TrimRight(lineSb.String(), " "))
+	}
+	return sb.String()
+}
+
 // TTYString returns a string for representing the buffer on the terminal.
 func (b *Buffer) TTYString() string {
 	if b == nil {
@@ -3,6 +3,8 @@ package term
 import (
 	"reflect"
 	"testing"
+
+	"github.com/elves/elvish/pkg/ui"
 )
 
 var cellsWidthTests = []struct {
@@ -308,6 +310,40 @@ var bufferTTYStringTests = []struct {
 	},
 }
 
+func TestBufferPlainString(t *testing.T) {
+	tests := []struct {
+		name string
+		buf  *Buffer
+		want string
+	}{
+		{"nil buffer", nil, ""},
+		{"empty buffer", NewBuffer(4), ""},
+		{
+			"styles are stripped",
+			NewBufferBuilder(4).
+				Write("AB").Write("C", ui.Bold).Write("D", ui.Inverse).
+				Newline().Write("XY", ui.Inverse).Buffer(),
+			"ABCD\nXY",
+		},
+		{
+			"trailing spaces are removed",
+			NewBufferBuilder(5).Write("a b  ", ui.Inverse).
+				Newline().Newline().Write(" c").Buffer(),
+			"a b\n\n c",
+		},
+		{
+			"wide characters",
+			NewBufferBuilder(4).Write("你好").Buffer(),
+			"你好",
+		},
+	}
+	for _, test := range tests {
+		if got := test.buf.PlainString(); got != test.want {
+			t.Errorf("%s: PlainString -> %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
 func TestBufferTTYString(t *testing.T) {
 	for _, test := range bufferTTYStringTests {
 		ttyString := test.buf.TTYString()
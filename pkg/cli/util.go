@@ -1,5 +1,7 @@
 package cli
 
+import "fmt"
+
 // GetCodeBuffer returns the code buffer of the main code area widget of the app.
 func GetCodeBuffer(a App) CodeBuffer {
 	return a.CodeArea().CopyState().Buffer
@@ -21,3 +23,17 @@ func Addon(a App) Widget {
 func SetAddon(a App, addon Widget) {
 	a.MutateState(func(s *State) { s.Addon = addon })
 }
+
+// CatchPanic calls f, recovering from any panic in it by showing the panic
+// value as a note. It returns whether f returned normally. Addons use it to
+// call user-supplied callbacks, so that a panicking callback doesn't crash the
+// app.
+func CatchPanic(a App, f func()) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			a.Notify(fmt.Sprintf("addon error: %v", r))
+		}
+	}()
+	f()
+	return true
+}
@@ -1,6 +1,7 @@
 package cli_test
 
 import (
+	"reflect"
 	"testing"
 
 	. "github.com/elves/elvish/pkg/cli"
@@ -23,3 +24,16 @@ func TestAddonUtils(t *testing.T) {
 		t.Errorf("Got addon %v, want %v", gotAddon, addon)
 	}
 }
+
+func TestCatchPanic(t *testing.T) {
+	app := NewApp(AppSpec{})
+	if ok := CatchPanic(app, func() {}); !ok {
+		t.Errorf("CatchPanic -> false, want true")
+	}
+	if ok := CatchPanic(app, func() { panic("boom") }); ok {
+		t.Errorf("CatchPanic -> true, want false")
+	}
+	if notes := app.CopyState().Notes; !reflect.DeepEqual(notes, []string{"addon error: boom"}) {
+		t.Errorf("got notes %q, want [addon error: boom]", notes)
+	}
+}
@@ -151,6 +151,19 @@ func (c *client) CmdsWithSeq(from, upto int) ([]store.Cmd, error) {
 	return res.Cmds, err
 }
 
+func (c *client) SetCmdExitStatus(seq, status int) error {
+	req := &api.SetCmdExitStatusRequest{Seq: seq, Status: status}
+	res := &api.SetCmdExitStatusResponse{}
+	return c.call("SetCmdExitStatus", req, res)
+}
+
+func (c *client) FailedCmds(from, upto int) ([]store.Cmd, error) {
+	req := &api.FailedCmdsRequest{From: from, Upto: upto}
+	res := &api.FailedCmdsResponse{}
+	err := c.call("FailedCmds", req, res)
+	return res.Cmds, err
+}
+
 func (c *client) NextCmd(from int, prefix string) (store.Cmd, error) {
 	req := &api.NextCmdRequest{From: from, Prefix: prefix}
 	res := &api.NextCmdResponse{}
@@ -179,6 +192,12 @@ func (c *client) DelDir(dir string) error {
 	return err
 }
 
+func (c *client) DecayScores(factor float64) error {
+	req := &api.DecayScoresRequest{Factor: factor}
+	res := &api.DecayScoresResponse{}
+	return c.call("DecayScores", req, res)
+}
+
 func (c *client) Dirs(blacklist map[string]struct{}) ([]store.Dir, error) {
 	req := &api.DirsRequest{Blacklist: blacklist}
 	res := &api.DirsResponse{}
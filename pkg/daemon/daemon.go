@@ -15,7 +15,7 @@ import (
 var logger = logutil.GetLogger("[daemon] ")
 
 // Version is the API version. It should be bumped any time the API changes.
-const Version = -93
+const Version = -92
 
 // Program is the daemon subprogram.
 var Program prog.Program = program{}
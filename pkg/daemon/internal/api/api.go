@@ -72,6 +72,23 @@ type CmdsWithSeqResponse struct {
 	Cmds []store.Cmd
 }
 
+type SetCmdExitStatusRequest struct {
+	Seq    int
+	Status int
+}
+
+type SetCmdExitStatusResponse struct {
+}
+
+type FailedCmdsRequest struct {
+	From int
+	Upto int
+}
+
+type FailedCmdsResponse struct {
+	Cmds []store.Cmd
+}
+
 type NextCmdRequest struct {
 	From   int
 	Prefix string
@@ -107,6 +124,12 @@ type DelDirRequest struct {
 
 type DelDirResponse struct{}
 
+type DecayScoresRequest struct {
+	Factor float64
+}
+
+type DecayScoresResponse struct{}
+
 type DirsRequest struct {
 	Blacklist map[string]struct{}
 }
@@ -83,6 +83,22 @@ func (s *service) CmdsWithSeq(req *api.CmdsWithSeqRequest, res *api.CmdsWithSeqR
 	return err
 }
 
+func (s *service) SetCmdExitStatus(req *api.SetCmdExitStatusRequest, res *api.SetCmdExitStatusResponse) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.store.SetCmdExitStatus(req.Seq, req.Status)
+}
+
+func (s *service) FailedCmds(req *api.FailedCmdsRequest, res *api.FailedCmdsResponse) error {
+	if s.err != nil {
+		return s.err
+	}
+	cmds, err := s.store.FailedCmds(req.From, req.Upto)
+	res.Cmds = cmds
+	return err
+}
+
 func (s *service) NextCmd(req *api.NextCmdRequest, res *api.NextCmdResponse) error {
 	if s.err != nil {
 		return s.err
@@ -115,6 +131,13 @@ func (s *service) DelDir(req *api.DelDirRequest, res *api.DelDirResponse) error
 	return s.store.DelDir(req.Dir)
 }
 
+func (s *service) DecayScores(req *api.DecayScoresRequest, res *api.DecayScoresResponse) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.store.DecayScores(req.Factor)
+}
+
 func (s *service) Dirs(req *api.DirsRequest, res *api.DirsResponse) error {
 	if s.err != nil {
 		return s.err
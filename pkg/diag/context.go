@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/elves/elvish/pkg/wcwidth"
 )
@@ -96,6 +97,17 @@ func (c *Context) ShowCompact(sourceIndent string) string {
 	return desc + c.relevantSource(sourceIndent+descIndent)
 }
 
+// LineCol returns the 1-based line and column numbers of the start of the
+// range. The column is counted in codepoints. If the position is unknown or
+// invalid, it returns 0, 0.
+func (c *Context) LineCol() (line, col int) {
+	if c.checkPosition() != nil {
+		return 0, 0
+	}
+	before := c.Source[:c.From]
+	return strings.Count(before, "\n") + 1, utf8.RuneCountInString(lastLine(before)) + 1
+}
+
 func (c *Context) checkPosition() error {
 	if c.From == -1 {
 		return fmt.Errorf("%s, unknown position", c.Name)
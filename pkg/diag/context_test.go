@@ -70,6 +70,26 @@ func TestContext(t *testing.T) {
 	}
 }
 
+func TestContext_LineCol(t *testing.T) {
+	for _, test := range []struct {
+		context           *Context
+		wantLine, wantCol int
+	}{
+		{parseContext("echo (bad)", "(", ")", true), 1, 6},
+		{parseContext("echo\n  (bad)", "(", ")", true), 2, 3},
+		{parseContext("你好\n你好 (bad)", "(", ")", true), 2, 4},
+		{NewContext("[test]", "echo", Ranging{From: -1, To: -1}), 0, 0},
+		{NewContext("[test]", "echo", Ranging{From: 5, To: 6}), 0, 0},
+	} {
+		line, col := test.context.LineCol()
+		if line != test.wantLine || col != test.wantCol {
+			t.Errorf("LineCol() of %q at %d -> %d, %d, want %d, %d",
+				test.context.Source, test.context.From,
+				line, col, test.wantLine, test.wantCol)
+		}
+	}
+}
+
 // Parse a string into a source range, using the first appearance of certain
 // texts as start and end positions.
 func parseContext(s, starter, ender string, endAfter bool) *Context {
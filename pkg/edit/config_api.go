@@ -71,17 +71,21 @@ func initAfterReadline(appSpec *cli.AppSpec, ev *eval.Evaler, ns eval.Ns) {
 // not run. The default value of this list contains a filter which
 // ignores command starts with space.
 
-func initAddCmdFilters(appSpec *cli.AppSpec, ev *eval.Evaler, ns eval.Ns, s histutil.Store) {
+func initAddCmdFilters(appSpec *cli.AppSpec, ed *Editor, ev *eval.Evaler, s histutil.Store) {
 	ignoreLeadingSpace := eval.NewGoFn("<ignore-cmd-with-leading-space>",
 		func(s string) bool { return !strings.HasPrefix(s, " ") })
 	filters := newListVar(vals.MakeList(ignoreLeadingSpace))
-	ns["add-cmd-filters"] = filters
+	ed.ns["add-cmd-filters"] = filters
 
 	appSpec.AfterReadline = append(appSpec.AfterReadline, func(code string) {
+		ed.lastCmdSeq = -1
 		if code != "" &&
 			callFilters(ev, "$<edit>:add-cmd-filters",
 				filters.Get().(vals.List), code) {
-			s.AddCmd(store.Cmd{Text: code, Seq: -1})
+			seq, err := s.AddCmd(store.Cmd{Text: code, Seq: -1})
+			if err == nil {
+				ed.lastCmdSeq = seq
+			}
 		}
 		// TODO(xiaq): Handle the error.
 	})
@@ -25,6 +25,11 @@ type Editor struct {
 
 	excMutex sync.RWMutex
 	excList  vals.List
+
+	st store.Store
+	// Sequence number of the last command added to the history, or -1 if the
+	// last command read was not added.
+	lastCmdSeq int
 }
 
 // An interface that wraps notifyf and notifyError. It is only implemented by
@@ -39,7 +44,7 @@ type notifier interface {
 func NewEditor(tty cli.TTY, ev *eval.Evaler, st store.Store) *Editor {
 	// Declare the Editor with a nil App first; some initialization functions
 	// require a notifier as an argument, but does not use it immediately.
-	ed := &Editor{ns: eval.Ns{}, excList: vals.EmptyList}
+	ed := &Editor{ns: eval.Ns{}, excList: vals.EmptyList, st: st, lastCmdSeq: -1}
 	appSpec := cli.AppSpec{TTY: tty}
 
 	hs, err := newHistStore(st)
@@ -50,7 +55,7 @@ func NewEditor(tty cli.TTY, ev *eval.Evaler, st store.Store) *Editor {
 	initHighlighter(&appSpec, ev)
 	initMaxHeight(&appSpec, ed.ns)
 	initReadlineHooks(&appSpec, ev, ed.ns)
-	initAddCmdFilters(&appSpec, ev, ed.ns, hs)
+	initAddCmdFilters(&appSpec, ed, ev, hs)
 	initInsertAPI(&appSpec, ed, ev, ed.ns)
 	initPrompts(&appSpec, ed, ev, ed.ns)
 	ed.app = cli.NewApp(appSpec)
@@ -58,7 +63,7 @@ func NewEditor(tty cli.TTY, ev *eval.Evaler, st store.Store) *Editor {
 	initExceptionsAPI(ed)
 	initCommandAPI(ed, ev)
 	initListings(ed, ev, st, hs)
-	initNavigation(ed, ev)
+	initNavigation(ed, ev, st)
 	initCompletion(ed, ev)
 	initHistWalk(ed, ev, hs)
 	initInstant(ed, ev)
@@ -74,6 +79,15 @@ func NewEditor(tty cli.TTY, ev *eval.Evaler, st store.Store) *Editor {
 	return ed
 }
 
+// RecordExitStatus records the exit status of the last command read, if it was
+// added to the command history.
+func (ed *Editor) RecordExitStatus(status int) error {
+	if ed.st == nil || ed.lastCmdSeq == -1 {
+		return nil
+	}
+	return ed.st.SetCmdExitStatus(ed.lastCmdSeq, status)
+}
+
 //elvdoc:var exceptions
 //
 // A list of exceptions thrown from callbacks such as prompts. Useful for
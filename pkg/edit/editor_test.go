@@ -27,6 +27,39 @@ func TestEditor_DoesNotAddEmptyCommandToHistory(t *testing.T) {
 	testCommands(t, f.Store /* no commands */)
 }
 
+func TestEditor_RecordExitStatus(t *testing.T) {
+	f := setup()
+	defer f.Cleanup()
+
+	feedInput(f.TTYCtrl, "echo x\n")
+	f.Wait()
+	f.Editor.RecordExitStatus(1)
+
+	testFailedCmds(t, f.Store, store.Cmd{Text: "echo x", Seq: 1})
+}
+
+func TestEditor_RecordExitStatus_CommandNotAdded(t *testing.T) {
+	f := setup()
+	defer f.Cleanup()
+
+	feedInput(f.TTYCtrl, " echo x\n")
+	f.Wait()
+	f.Editor.RecordExitStatus(1)
+
+	testFailedCmds(t, f.Store /* no commands */)
+}
+
+func testFailedCmds(t *testing.T, store store.Store, wantCmds ...store.Cmd) {
+	t.Helper()
+	cmds, err := store.FailedCmds(0, 1024)
+	if err != nil {
+		panic(err)
+	}
+	if !reflect.DeepEqual(cmds, wantCmds) {
+		t.Errorf("got failed cmds %v, want %v", cmds, wantCmds)
+	}
+}
+
 func testCommands(t *testing.T, store store.Store, wantCmds ...string) {
 	t.Helper()
 	cmds, err := store.Cmds(0, 1024)
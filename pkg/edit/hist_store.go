@@ -1,6 +1,7 @@
 package edit
 
 import (
+	"errors"
 	"sync"
 
 	"github.com/elves/elvish/pkg/cli/histutil"
@@ -32,6 +33,21 @@ func (s *histStore) AllCmds() ([]store.Cmd, error) {
 	return s.hs.AllCmds()
 }
 
+var errNoDB = errors.New("no database")
+
+// FailedCmds returns all commands in the database that have a recorded non-zero
+// exit status.
+func (s *histStore) FailedCmds() ([]store.Cmd, error) {
+	if s.db == nil {
+		return nil, errNoDB
+	}
+	upper, err := s.db.NextCmdSeq()
+	if err != nil {
+		return nil, err
+	}
+	return s.db.FailedCmds(0, upper)
+}
+
 func (s *histStore) Cursor(prefix string) histutil.Cursor {
 	s.m.Lock()
 	defer s.m.Unlock()
@@ -53,9 +53,9 @@ func initHistlist(ed *Editor, ev *eval.Evaler, histStore histutil.Store, commonB
 		eval.Ns{
 			"binding": bindingVar,
 		}.AddGoFns("<edit:histlist>", map[string]interface{}{
-			"start": func() {
+			"start": func(opts histlistOpts) {
 				histlist.Start(ed.app, histlist.Config{
-					Binding: binding, Store: histStore,
+					Binding: binding, Store: histStore, OnlyFailed: opts.OnlyFailed,
 					CaseSensitive: func() bool {
 						return caseSensitive.Get().(bool)
 					},
@@ -77,6 +77,10 @@ func initHistlist(ed *Editor, ev *eval.Evaler, histStore histutil.Store, commonB
 		}))
 }
 
+type histlistOpts struct{ OnlyFailed bool }
+
+func (*histlistOpts) SetDefaultOptions() {}
+
 func initLastcmd(ed *Editor, ev *eval.Evaler, histStore histutil.Store, commonBindingVar vars.PtrVar) {
 	bindingVar := newBindingVar(EmptyBindingMap)
 	binding := newMapBinding(ed, ev, bindingVar, commonBindingVar)
@@ -112,7 +116,27 @@ func initLocation(ed *Editor, ev *eval.Evaler, st store.Store, commonBindingVar
 				IteratePinned:     adaptToIterateString(pinnedVar),
 				IterateHidden:     adaptToIterateString(hiddenVar),
 				IterateWorkspaces: workspaceIterator,
+				NoColor:           os.Getenv("TERM") == "dumb",
+				ToggleOrder:       true,
+				SavePinned: func(pinned []string) error {
+					l := vals.EmptyList
+					for _, dir := range pinned {
+						l = l.Cons(dir)
+					}
+					return pinnedVar.Set(l)
+				},
+				DeleteEntry: func(path string) error {
+					if st == nil {
+						return errStoreOffline
+					}
+					return st.DelDir(path)
+				},
 			})
+		}).AddGoFn("<edit:location>", "decay-scores", func(factor float64) error {
+			if st == nil {
+				return errStoreOffline
+			}
+			return location.DecayScores(dirStore{ev, st}, factor)
 		}))
 	ev.AddAfterChdir(func(string) {
 		wd, err := os.Getwd()
@@ -225,6 +249,17 @@ func listingRefilter(app cli.App) {
 //
 // A map mapping types of workspaces to their patterns.
 
+//elvdoc:fn location:decay-scores
+//
+// ```elvish
+// edit:location:decay-scores $factor
+// ```
+//
+// Multiplies the scores of all directories in the directory history by
+// `$factor`, which must be between 0 and 1, so that directories visited long
+// ago rank lower. Scores that become very small are truncated to 0. This can be
+// run periodically, for example when starting the shell.
+
 func adaptToIterateString(variable vars.Var) func(func(string)) {
 	return func(f func(s string)) {
 		vals.Iterate(variable.Get(), func(v interface{}) bool {
@@ -265,6 +300,14 @@ func (d dirStore) Dirs(blacklist map[string]struct{}) ([]store.Dir, error) {
 	return d.st.Dirs(blacklist)
 }
 
+func (d dirStore) DecayScores(factor float64) error {
+	return d.st.DecayScores(factor)
+}
+
+func (d dirStore) Bump(path string) error {
+	return d.st.AddDir(path, 1)
+}
+
 func (d dirStore) Getwd() (string, error) {
 	return os.Getwd()
 }
@@ -3,7 +3,10 @@ package edit
 import (
 	"testing"
 
+	"github.com/elves/elvish/pkg/cli/clitest"
 	"github.com/elves/elvish/pkg/cli/term"
+	"github.com/elves/elvish/pkg/eval"
+	"github.com/elves/elvish/pkg/parse"
 	"github.com/elves/elvish/pkg/store"
 	"github.com/elves/elvish/pkg/ui"
 )
@@ -62,6 +65,26 @@ func TestHistlistAddon(t *testing.T) {
 	)
 }
 
+func TestHistlistAddon_OnlyFailed(t *testing.T) {
+	f := setup(storeOp(func(s store.Store) {
+		s.AddCmd("ls")
+		s.AddCmd("false")
+		s.AddCmd("echo")
+		s.SetCmdExitStatus(1, 0)
+		s.SetCmdExitStatus(2, 1)
+	}))
+	defer f.Cleanup()
+
+	evals(f.Evaler, `edit:histlist:start &only-failed`)
+	f.TestTTY(t,
+		"~> \n",
+		" HISTORY (failed) (dedup on)  ", Styles,
+		"***************************** ", term.DotHere, "\n",
+		"   2 false                                        ", Styles,
+		"++++++++++++++++++++++++++++++++++++++++++++++++++",
+	)
+}
+
 func TestLastCmdAddon(t *testing.T) {
 	f := setup(storeOp(func(s store.Store) {
 		s.AddCmd("echo hello world")
@@ -81,6 +104,36 @@ func TestLastCmdAddon(t *testing.T) {
 	)
 }
 
+func TestLocation_DecayScores(t *testing.T) {
+	f := setup(storeOp(func(s store.Store) {
+		s.AddDir("/tmp", 1)
+	}))
+	defer f.Cleanup()
+
+	evals(f.Evaler, "edit:location:decay-scores 0.5")
+	dirs, err := f.Store.Dirs(store.NoBlacklist)
+	if err != nil || len(dirs) != 1 || dirs[0].Score != store.DirScoreIncrement*0.5 {
+		t.Errorf("got dirs %v, err %v, want score %v", dirs, err, store.DirScoreIncrement*0.5)
+	}
+}
+
+func TestLocation_DecayScores_StoreOffline(t *testing.T) {
+	tty, _ := clitest.NewFakeTTY()
+	ev := eval.NewEvaler()
+	ed := NewEditor(tty, ev, nil)
+	ev.InstallModule("edit", ed.Ns())
+
+	src := parse.Source{Name: "[test]", Code: "use edit; edit:location:decay-scores 0.5"}
+	op, err := ev.ParseAndCompile(src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ev.Eval(op, eval.EvalCfg{})
+	if eval.Reason(err) != errStoreOffline {
+		t.Errorf("got error %v, want %v", err, errStoreOffline)
+	}
+}
+
 func TestCustomListing_PassingList(t *testing.T) {
 	f := setup()
 	defer f.Cleanup()
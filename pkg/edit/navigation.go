@@ -2,11 +2,13 @@ package edit
 
 import (
 	"github.com/elves/elvish/pkg/cli"
+	"github.com/elves/elvish/pkg/cli/addons/location"
 	"github.com/elves/elvish/pkg/cli/addons/navigation"
 	"github.com/elves/elvish/pkg/eval"
 	"github.com/elves/elvish/pkg/eval/vals"
 	"github.com/elves/elvish/pkg/eval/vars"
 	"github.com/elves/elvish/pkg/parse"
+	"github.com/elves/elvish/pkg/store"
 )
 
 //elvdoc:var selected-file
@@ -55,6 +57,11 @@ func navToggleShowHidden(app cli.App) {
 	navigation.MutateShowHidden(app, func(b bool) bool { return !b })
 }
 
+//elvdoc:fn navigation:remember
+//
+// Bumps the score of the current directory in the directory history, as if it
+// had been visited, so that it ranks higher in the location mode.
+
 //elvdoc:var navigation:width-ratio
 //
 // A list of 3 integers, used for specifying the width ratio of the 3 columns in
@@ -84,7 +91,7 @@ func convertNavWidthRatio(v interface{}) [3]int {
 	return ret
 }
 
-func initNavigation(ed *Editor, ev *eval.Evaler) {
+func initNavigation(ed *Editor, ev *eval.Evaler, st store.Store) {
 	bindingVar := newBindingVar(EmptyBindingMap)
 	binding := newMapBinding(ed, ev, bindingVar)
 	widthRatioVar := newListVar(vals.MakeList(1.0, 3.0, 4.0))
@@ -110,6 +117,12 @@ func initNavigation(ed *Editor, ev *eval.Evaler) {
 					WidthRatio: func() [3]int {
 						return convertNavWidthRatio(widthRatioVar.Get())
 					},
+					Remember: func(path string) error {
+						if st == nil {
+							return errStoreOffline
+						}
+						return location.Bump(dirStore{ev, st}, path)
+					},
 				})
 			},
 			"left":      func() { navigation.Ascend(app) },
@@ -127,5 +140,7 @@ func initNavigation(ed *Editor, ev *eval.Evaler) {
 
 			"trigger-filter":       func() { navToggleFilter(app) },
 			"trigger-shown-hidden": func() { navToggleShowHidden(app) },
+
+			"remember": func() { navigation.Remember(app) },
 		}))
 }
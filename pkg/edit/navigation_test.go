@@ -2,9 +2,11 @@ package edit
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/elves/elvish/pkg/cli/lscolors"
+	"github.com/elves/elvish/pkg/store"
 	"github.com/elves/elvish/pkg/testutil"
 
 	"github.com/elves/elvish/pkg/cli/term"
@@ -71,6 +73,18 @@ func TestNavigation_WidthRatio(t *testing.T) {
 	)
 }
 
+func TestNavigation_Remember(t *testing.T) {
+	f, cleanup := setupNav()
+	defer cleanup()
+
+	evals(f.Evaler, `edit:navigation:start`, `edit:navigation:remember`)
+	dirs, err := f.Store.Dirs(store.NoBlacklist)
+	wantPath := filepath.Join(f.Home, "d")
+	if err != nil || len(dirs) != 1 || dirs[0].Path != wantPath {
+		t.Errorf("got dirs %v, err %v, want only %v", dirs, err, wantPath)
+	}
+}
+
 func setupNav() (*fixture, func()) {
 	f := setup()
 	restoreLsColors := lscolors.WithTestLsColors()
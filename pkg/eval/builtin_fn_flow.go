@@ -1,6 +1,7 @@
 package eval
 
 import (
+	"errors"
 	"sync"
 
 	"github.com/elves/elvish/pkg/diag"
@@ -15,11 +16,12 @@ func init() {
 	addBuiltinFns(map[string]interface{}{
 		"run-parallel": runParallel,
 		// Exception and control
-		"fail":        fail,
-		"multi-error": multiErrorFn,
-		"return":      returnFn,
-		"break":       breakFn,
-		"continue":    continueFn,
+		"fail":           fail,
+		"fail-with-code": failWithCode,
+		"multi-error":    multiErrorFn,
+		"return":         returnFn,
+		"break":          breakFn,
+		"continue":       continueFn,
 		// Iterations.
 		"each":  each,
 		"peach": peach,
@@ -242,17 +244,86 @@ func fail(v interface{}) error {
 	return FailError{v}
 }
 
+// CodedFailError is an error returned by the "fail-with-code" command.
+type CodedFailError struct{ ErrorCode, Message string }
+
+// Error returns the message.
+func (e CodedFailError) Error() string { return e.Message }
+
+// Code returns the code, implementing Coder.
+func (e CodedFailError) Code() string { return e.ErrorCode }
+
+// Fields returns a structmap for accessing fields from Elvish.
+func (e CodedFailError) Fields() vals.StructMap { return codedFailFields{e} }
+
+type codedFailFields struct{ e CodedFailError }
+
+func (codedFailFields) IsStructMap() {}
+
+func (f codedFailFields) Type() string    { return "fail" }
+func (f codedFailFields) Content() string { return f.e.Message }
+func (f codedFailFields) Code() string    { return f.e.ErrorCode }
+
+// ErrEmptyCode is returned by "fail-with-code" when the code is empty.
+var ErrEmptyCode = errors.New("code must not be empty")
+
+//elvdoc:fn fail-with-code
+//
+// ```elvish
+// fail-with-code $code $message
+// ```
+//
+// Throws an exception with the given message and code. The code is a stable
+// identifier of the kind of the error, like `out-of-range`, which can be
+// checked by catching code without relying on the message. It must not be
+// empty.
+//
+// The reason of the exception is like that of [`fail`](#fail), with an
+// additional `code` field. The code is also shown after the message, and in the
+// output of [`exc:to-map`](exc.html#excto-map).
+//
+// ```elvish-transcript
+// ~> fail-with-code out-of-range 'index too large'
+// Exception: index too large [out-of-range]
+// [tty 1], line 1: fail-with-code out-of-range 'index too large'
+// ~> put ?(fail-with-code out-of-range 'index too large')[reason][code]
+// ▶ out-of-range
+// ```
+//
+// @cf fail
+
+func failWithCode(code, message string) error {
+	if code == "" {
+		return ErrEmptyCode
+	}
+	return CodedFailError{code, message}
+}
+
 func multiErrorFn(excs ...*Exception) error {
 	return PipelineError{excs}
 }
 
 //elvdoc:fn return
 //
+// ```elvish
+// return $value...
+// ```
+//
 // Raises the special "return" exception. When raised inside a named function
 // (defined by the [`fn` keyword](../language.html#function-definition-fn)) it
 // is captured by the function and causes the function to terminate. It is not
 // captured by an anonymous function (aka [lambda](../language.html#lambda)).
 //
+// If any `$value` is given, the function outputs them before terminating:
+//
+// ```elvish-transcript
+// ~> fn f []{ put a; return b c; put d }
+// ~> f
+// ▶ a
+// ▶ b
+// ▶ c
+// ```
+//
 // Because `return` raises an exception it can be caught by a
 // [`try`](language.html#exception-control-try) block. If not caught, either
 // implicitly by a named function or explicitly, it causes a failure like any
@@ -278,8 +349,11 @@ func multiErrorFn(excs ...*Exception) error {
 // ▶ no
 // ```
 
-func returnFn() error {
-	return Return
+func returnFn(values ...interface{}) error {
+	if len(values) == 0 {
+		return Return
+	}
+	return FlowReturn{values}
 }
 
 //elvdoc:fn break
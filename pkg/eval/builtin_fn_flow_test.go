@@ -33,6 +33,18 @@ func TestBuiltinFnFlow(t *testing.T) {
 		That("put ?(fail 1)[reason][type]").Puts("fail"),
 		That("put ?(fail 1)[reason][content]").Puts("1"),
 
+		That("fail-with-code bad-thing 'bad thing'").Throws(
+			CodedFailError{"bad-thing", "bad thing"},
+			"fail-with-code bad-thing 'bad thing'"),
+		That("put ?(fail-with-code bad-thing 'bad thing')[reason][type]").Puts("fail"),
+		That("put ?(fail-with-code bad-thing 'bad thing')[reason][content]").
+			Puts("bad thing"),
+		That("put ?(fail-with-code bad-thing 'bad thing')[reason][code]").
+			Puts("bad-thing"),
+		That("fail-with-code '' 'bad thing'").Throws(ErrEmptyCode),
+		That("fail-with-code bad-thing").Throws(AnyError),
+
 		That(`return`).Throws(Return),
+		That(`return a b`).Throws(FlowReturn{[]interface{}{"a", "b"}}),
 	)
 }
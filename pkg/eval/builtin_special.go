@@ -39,6 +39,8 @@ type noSuchModule struct{ spec string }
 
 func (err noSuchModule) Error() string { return "no such module: " + err.spec }
 
+func (err noSuchModule) Code() string { return "no-such-module" }
+
 func init() {
 	// Needed to avoid initialization loop
 	builtinSpecials = map[string]compileBuiltin{
@@ -207,11 +209,22 @@ func (op fnWrap) Range() diag.Ranging { return op.effectOp.(diag.Ranger).Range()
 
 func (op fnWrap) exec(fm *Frame) error {
 	err := op.effectOp.exec(fm)
-	if err != nil && Reason(err) != Return {
-		// rethrow
-		return err
+	switch reason := Reason(err).(type) {
+	case nil:
+		return nil
+	case Flow:
+		if reason == Return {
+			return nil
+		}
+	case FlowReturn:
+		out := fm.OutputChan()
+		for _, v := range reason.Values {
+			out <- v
+		}
+		return nil
 	}
-	return nil
+	// rethrow
+	return err
 }
 
 // UseForm = 'use' StringPrimary
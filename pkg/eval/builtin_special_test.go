@@ -110,6 +110,11 @@ func TestBuiltinSpecial(t *testing.T) {
 			Puts("x=lorem.", "x=ipsum."),
 		// return.
 		That("fn f []{ put a; return; put b }; f").Puts("a"),
+		// return with values.
+		That("fn f []{ put a; return b c; put d }; f").Puts("a", "b", "c"),
+		That("fn f []{ return [x] }; put (f)[0]").Puts("x"),
+		// Values returned from an inner function are not returned again.
+		That("fn g []{ return a }; fn f []{ g; return b }; f").Puts("a", "b"),
 	)
 }
 
@@ -14,6 +14,9 @@ type OutOfRange struct {
 	Actual    string
 }
 
+// Code returns "out-of-range".
+func (e OutOfRange) Code() string { return "out-of-range" }
+
 func (e OutOfRange) Error() string {
 	if e.ValidHigh < e.ValidLow {
 		return fmt.Sprintf(
@@ -32,6 +35,9 @@ type BadValue struct {
 	Actual string
 }
 
+// Code returns "bad-value".
+func (e BadValue) Code() string { return "bad-value" }
+
 func (e BadValue) Error() string {
 	return fmt.Sprintf(
 		"bad value: %v must be %v, but is %v", e.What, e.Valid, e.Actual)
@@ -46,6 +52,9 @@ type ArityMismatch struct {
 	Actual    int
 }
 
+// Code returns "arity-mismatch".
+func (e ArityMismatch) Code() string { return "arity-mismatch" }
+
 func (e ArityMismatch) Error() string {
 	switch {
 	case e.ValidHigh == e.ValidLow:
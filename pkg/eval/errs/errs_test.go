@@ -41,3 +41,16 @@ func TestErrorMessages(t *testing.T) {
 		}
 	}
 }
+
+func TestCodes(t *testing.T) {
+	codes := map[interface{ Code() string }]string{
+		OutOfRange{}:    "out-of-range",
+		BadValue{}:      "bad-value",
+		ArityMismatch{}: "arity-mismatch",
+	}
+	for err, wantCode := range codes {
+		if gotCode := err.Code(); gotCode != wantCode {
+			t.Errorf("got code %v, want %v", gotCode, wantCode)
+		}
+	}
+}
@@ -240,6 +240,14 @@ func (ev *Evaler) SetArgs(args []string) {
 	ev.Builtin["args"] = vars.NewReadOnly(v)
 }
 
+// SetAllowedExitCodes sets the non-zero exit codes of external commands that
+// should not be turned into exceptions.
+func (ev *Evaler) SetAllowedExitCodes(codes ...int) {
+	ev.state.mutex.Lock()
+	defer ev.state.mutex.Unlock()
+	ev.state.allowedExitCodes = codes
+}
+
 // SetLibDir sets the library directory, in which external modules are to be
 // found.
 func (ev *Evaler) SetLibDir(libDir string) {
@@ -2,14 +2,16 @@ package eval
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"reflect"
 	"strconv"
 	"syscall"
-	"unsafe"
 
 	"github.com/elves/elvish/pkg/diag"
 	"github.com/elves/elvish/pkg/eval/vals"
 	"github.com/elves/elvish/pkg/parse"
+	"github.com/elves/elvish/pkg/ui"
 	"github.com/xiaq/persistent/hash"
 )
 
@@ -31,6 +33,13 @@ type StackTrace struct {
 	Next *StackTrace
 }
 
+// Coder may be implemented by the reason of an exception to identify the kind
+// of the error with a machine-stable code, like "out-of-range". Unlike error
+// messages, codes are not expected to change between versions.
+type Coder interface {
+	Code() string
+}
+
 // Reason returns the Reason field if err is an *Exception. Otherwise it returns
 // err itself.
 func Reason(err error) error {
@@ -40,55 +49,268 @@ func Reason(err error) error {
 	return err
 }
 
+// WrapException returns an exception with the given reason and a stack trace
+// consisting of only the given context. It is useful for wrapping errors from
+// lower-level functions, which can then be linked to the exception of the
+// enclosing evaluation context with Chain.
+func WrapException(reason error, ctx *diag.Context) *Exception {
+	if ctx == nil {
+		return &Exception{reason, nil}
+	}
+	return &Exception{reason, &StackTrace{Head: ctx}}
+}
+
+// NewException returns an exception with the given reason and the traceback of
+// the given frame, which is the traceback of the code that is calling into Go.
+// If err is already an *Exception, it is returned as is. If err is nil, nil is
+// returned.
+func NewException(err error, fm *Frame) *Exception {
+	switch err := err.(type) {
+	case nil:
+		return nil
+	case *Exception:
+		return err
+	}
+	if fm == nil {
+		return &Exception{err, nil}
+	}
+	return &Exception{err, fm.traceback}
+}
+
+// Chain returns a new exception with the reason of exc, whose stack trace is
+// that of exc with the stack trace of parent, the exception of an enclosing
+// evaluation context, linked to its outer end, so that the traceback covers
+// both. The parent's reason is not used. Neither exc nor parent is modified,
+// so it is safe to call Chain on OK. It returns nil if exc is nil.
+func (exc *Exception) Chain(parent *Exception) *Exception {
+	if exc == nil {
+		return nil
+	}
+	if parent == nil {
+		return &Exception{exc.Reason, exc.StackTrace}
+	}
+	// The nodes of stack traces may be shared, so the stack trace of exc is
+	// copied rather than modified in place.
+	var heads []*diag.Context
+	for s := exc.StackTrace; s != nil; s = s.Next {
+		heads = append(heads, s.Head)
+	}
+	stackTrace := parent.StackTrace
+	for i := len(heads) - 1; i >= 0; i-- {
+		stackTrace = &StackTrace{Head: heads[i], Next: stackTrace}
+	}
+	return &Exception{exc.Reason, stackTrace}
+}
+
 // OK is a pointer to the zero value of Exception, representing the absence of
 // exception.
 var OK = &Exception{}
 
+// ReasonStyle is the style used for showing the reason of an exception, unless
+// the reason implements diag.Shower.
+var ReasonStyle = ui.Style{Foreground: ui.Red, Bold: true}
+
+// MaxTracebackFrames is the maximum number of stack frames to show in the
+// traceback of an exception. If a traceback has more frames, the innermost
+// frames and the outermost frame are shown, with the rest elided. If zero, all
+// frames are shown.
+var MaxTracebackFrames = 0
+
+// FrameRenderer, if not nil, is used to show each stack frame in the traceback
+// of an exception, instead of the default diag.Context.Show and
+// diag.Context.ShowCompact. It is called with the frame, the buffer to write
+// to, and the indentation to use for lines after the first one. It can be used
+// to customize how the names of frames are shown, for example to shorten them
+// or turn them into links.
+var FrameRenderer func(frame *diag.Context, buf *bytes.Buffer, indent string)
+
 // Error returns the message of the cause of the exception.
 func (exc *Exception) Error() string {
 	return exc.Reason.Error()
 }
 
-// Show shows the exception.
+// Unwrap returns the reason of the exception, so that errors.Is and errors.As
+// can be used to inspect it.
+func (exc *Exception) Unwrap() error {
+	return exc.Reason
+}
+
+// Code returns the code of the reason of the exception if it implements Coder,
+// or an empty string otherwise.
+func (exc *Exception) Code() string {
+	if coder, ok := exc.Reason.(Coder); ok {
+		return coder.Code()
+	}
+	return ""
+}
+
+// Summary returns a one-line summary of the exception, consisting of the
+// location of the innermost stack frame, if there is one, and the message of
+// the reason, like "a.elv:12:3: bad value". It returns "ok" for OK.
+func (exc *Exception) Summary() string {
+	if exc.Reason == nil {
+		return "ok"
+	}
+	if exc.StackTrace == nil {
+		return exc.Reason.Error()
+	}
+	head := exc.StackTrace.Head
+	line, col := head.LineCol()
+	return fmt.Sprintf("%s:%d:%d: %s", head.Name, line, col, exc.Reason.Error())
+}
+
+// Show shows the exception. If the reason has a code, it is shown in brackets
+// after the reason. If the reason is a PipelineError, each of the exceptions
+// in it is shown under the traceback, indented and numbered by its index in the
+// pipeline.
 func (exc *Exception) Show(indent string) string {
 	buf := new(bytes.Buffer)
 
 	var causeDescription string
+	pipeErr, isPipeErr := exc.Reason.(PipelineError)
 	if shower, ok := exc.Reason.(diag.Shower); ok {
 		causeDescription = shower.Show(indent)
 	} else if exc.Reason == nil {
 		causeDescription = "ok"
+	} else if isPipeErr {
+		// The exceptions are shown in full below.
+		n := pipeErr.numErrors()
+		noun := " errors in pipeline"
+		if n == 1 {
+			noun = " error in pipeline"
+		}
+		causeDescription = "\033[" + ReasonStyle.SGR() + "m" +
+			strconv.Itoa(n) + noun + "\033[m"
 	} else {
-		causeDescription = "\033[31;1m" + exc.Reason.Error() + "\033[m"
+		causeDescription = "\033[" + ReasonStyle.SGR() + "m" + exc.Reason.Error() + "\033[m"
 	}
 	fmt.Fprintf(buf, "Exception: %s", causeDescription)
+	if code := exc.Code(); code != "" {
+		fmt.Fprintf(buf, " [%s]", code)
+	}
 
 	if exc.StackTrace != nil {
 		buf.WriteString("\n")
 		if exc.StackTrace.Next == nil {
-			buf.WriteString(exc.StackTrace.Head.ShowCompact(indent))
+			buf.WriteString(indent)
+			if FrameRenderer != nil {
+				FrameRenderer(exc.StackTrace.Head, buf, indent)
+			} else {
+				buf.WriteString(exc.StackTrace.Head.ShowCompact(indent))
+			}
 		} else {
 			buf.WriteString(indent + "Traceback:")
+			var frames []*diag.Context
 			for tb := exc.StackTrace; tb != nil; tb = tb.Next {
-				buf.WriteString("\n" + indent + "  ")
-				buf.WriteString(tb.Head.Show(indent + "    "))
+				frames = append(frames, tb.Head)
+			}
+			writeFrames := func(frames []*diag.Context) {
+				for _, frame := range frames {
+					buf.WriteString("\n" + indent + "  ")
+					if FrameRenderer != nil {
+						FrameRenderer(frame, buf, indent+"    ")
+					} else {
+						buf.WriteString(frame.Show(indent + "    "))
+					}
+				}
+			}
+			if max := MaxTracebackFrames; max <= 0 || len(frames) <= max {
+				writeFrames(frames)
+			} else {
+				// Keep the innermost frames and, if there is room, the
+				// outermost frame.
+				inner, outer := frames[:max-1], frames[len(frames)-1:]
+				if max == 1 {
+					inner, outer = frames[:1], nil
+				}
+				writeFrames(inner)
+				elided := len(frames) - len(inner) - len(outer)
+				fmt.Fprintf(buf, "\n%s  … %d more frame", indent, elided)
+				if elided > 1 {
+					buf.WriteString("s")
+				}
+				writeFrames(outer)
 			}
 		}
 	}
 
-	if pipeExcs, ok := exc.Reason.(PipelineError); ok {
+	if isPipeErr {
 		buf.WriteString("\n" + indent + "Caused by:")
-		for _, e := range pipeExcs.Errors {
-			if e == OK {
+		for i, e := range pipeErr.Errors {
+			if e == nil || e.Reason == nil {
 				continue
 			}
-			buf.WriteString("\n" + indent + "  " + e.Show(indent+"  "))
+			fmt.Fprintf(buf, "\n%s  #%d %s", indent, i, e.Show(indent+"    "))
 		}
 	}
 
 	return buf.String()
 }
 
+// ShowPlain is like Show, but without any escape sequences for styling, which
+// is suitable when the output is not a terminal.
+func (exc *Exception) ShowPlain(indent string) string {
+	var buf bytes.Buffer
+	for _, seg := range ui.ParseSGREscapedText(exc.Show(indent)) {
+		buf.WriteString(seg.Text)
+	}
+	return buf.String()
+}
+
+// MarshalJSON encodes the exception as a JSON object. The object has a
+// "reason" field containing the error message of the reason (or null if the
+// exception is $ok), a "code" field containing the code of the reason if it
+// has one, a "fields" field containing the fields of the reason if it has any,
+// and a "traceback" field containing the stack frames, innermost
+// first, each with "name", "line" and "col" fields.
+func (exc *Exception) MarshalJSON() ([]byte, error) {
+	type frameJSON struct {
+		Name string `json:"name"`
+		Line int    `json:"line"`
+		Col  int    `json:"col"`
+	}
+	var j struct {
+		Reason    interface{}            `json:"reason"`
+		Code      string                 `json:"code,omitempty"`
+		Fields    map[string]interface{} `json:"fields,omitempty"`
+		Traceback []frameJSON            `json:"traceback"`
+	}
+	if exc.Reason != nil {
+		j.Reason = exc.Reason.Error()
+	}
+	j.Code = exc.Code()
+	if r, ok := exc.Reason.(interface{ Fields() vals.StructMap }); ok {
+		j.Fields = map[string]interface{}{}
+		vals.IterateKeys(r.Fields(), func(k interface{}) bool {
+			v, _ := vals.Index(r.Fields(), k)
+			j.Fields[vals.ToString(k)] = toJSONValue(v)
+			return true
+		})
+	}
+	j.Traceback = []frameJSON{}
+	for tb := exc.StackTrace; tb != nil; tb = tb.Next {
+		line, col := tb.Head.LineCol()
+		j.Traceback = append(j.Traceback, frameJSON{tb.Head.Name, line, col})
+	}
+	return json.Marshal(j)
+}
+
+// Converts an Elvish value into a value that can be encoded as JSON.
+func toJSONValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string, bool, int, float64, json.Marshaler:
+		return v
+	case vals.List:
+		var elems []interface{}
+		for it := v.Iterator(); it.HasElem(); it.Next() {
+			elems = append(elems, toJSONValue(it.Elem()))
+		}
+		return elems
+	default:
+		return vals.Repr(v, vals.NoPretty)
+	}
+}
+
 // Kind returns "exception".
 func (exc *Exception) Kind() string {
 	return "exception"
@@ -103,14 +325,51 @@ func (exc *Exception) Repr(indent int) string {
 	return "[&reason=" + vals.Repr(exc.Reason, indent+1) + "]"
 }
 
-// Equal compares by address.
+// ReprWithTraceback is like Repr, but also includes a compact summary of the
+// stack trace if there is one, as a list of name:line:col strings, innermost
+// first.
+func (exc *Exception) ReprWithTraceback(indent int) string {
+	if exc.Reason == nil || exc.StackTrace == nil {
+		return exc.Repr(indent)
+	}
+	frames := vals.EmptyList
+	for tb := exc.StackTrace; tb != nil; tb = tb.Next {
+		line, col := tb.Head.LineCol()
+		frames = frames.Cons(fmt.Sprintf("%s:%d:%d", tb.Head.Name, line, col))
+	}
+	return "[&reason=" + vals.Repr(exc.Reason, indent+1) +
+		" &traceback=" + vals.Repr(frames, indent+1) + "]"
+}
+
+// Equal returns whether rhs is an exception with an equivalent reason; the
+// tracebacks are not compared. Two reasons are equivalent if they are both nil,
+// or have the same type and the same message. In particular, an exception is
+// equal to another exception with the same reason, while an exception whose
+// reason wraps another error is not equal to one with the wrapped error, even
+// if errors.Is would match them. A nil *Exception is only equal to another nil
+// *Exception.
 func (exc *Exception) Equal(rhs interface{}) bool {
-	return exc == rhs
+	rexc, ok := rhs.(*Exception)
+	if !ok {
+		return false
+	}
+	if exc == nil || rexc == nil {
+		return exc == rexc
+	}
+	if exc.Reason == nil || rexc.Reason == nil {
+		return exc.Reason == nil && rexc.Reason == nil
+	}
+	return reflect.TypeOf(exc.Reason) == reflect.TypeOf(rexc.Reason) &&
+		exc.Reason.Error() == rexc.Reason.Error()
 }
 
-// Hash returns the hash of the address.
+// Hash returns the hash of the message of the reason. A nil exception has the
+// same hash as OK.
 func (exc *Exception) Hash() uint32 {
-	return hash.Pointer(unsafe.Pointer(exc))
+	if exc == nil || exc.Reason == nil {
+		return 0
+	}
+	return hash.String(exc.Reason.Error())
 }
 
 // Bool returns whether this exception has a nil cause; that is, it is $ok.
@@ -131,7 +390,9 @@ type PipelineError struct {
 	Errors []*Exception
 }
 
-// Error returns a plain text representation of the pipeline error.
+// Error returns a plain text representation of the pipeline error. Each
+// component is prefixed with its index in the pipeline, and components that
+// did not error are shown as <nil>.
 func (pe PipelineError) Error() string {
 	b := new(bytes.Buffer)
 	b.WriteString("(")
@@ -139,6 +400,7 @@ func (pe PipelineError) Error() string {
 		if i > 0 {
 			b.WriteString(" | ")
 		}
+		fmt.Fprintf(b, "#%d ", i)
 		if e == nil || e.Reason == nil {
 			b.WriteString("<nil>")
 		} else {
@@ -149,25 +411,33 @@ func (pe PipelineError) Error() string {
 	return b.String()
 }
 
+// Returns the number of components that errored.
+func (pe PipelineError) numErrors() int {
+	n := 0
+	for _, e := range pe.Errors {
+		if e != nil && e.Reason != nil {
+			n++
+		}
+	}
+	return n
+}
+
 // MakePipelineError builds an error from the execution results of multiple
 // commands in a pipeline.
 //
-// If all elements are either nil or OK, it returns nil. If there is exactly
-// non-nil non-OK Exception, it returns it. Otherwise, it return a PipelineError
-// built from the slice, with nil items turned into OK's for easier access from
-// Elvish code.
+// Exceptions whose reasons are themselves PipelineError's, as thrown by nested
+// pipelines, are replaced by the exceptions they contain. If all elements are
+// then either nil or OK, it returns nil. If there is exactly non-nil non-OK
+// Exception, it returns it. Otherwise, it return a PipelineError built from
+// the slice, with nil items turned into OK's for easier access from Elvish
+// code.
 func MakePipelineError(excs []*Exception) error {
-	newexcs := make([]*Exception, len(excs))
+	newexcs := flattenPipelineExceptions(make([]*Exception, 0, len(excs)), excs)
 	notOK, lastNotOK := 0, 0
-	for i, e := range excs {
-		if e == nil {
-			newexcs[i] = OK
-		} else {
-			newexcs[i] = e
-			if e.Reason != nil {
-				notOK++
-				lastNotOK = i
-			}
+	for i, e := range newexcs {
+		if e.Reason != nil {
+			notOK++
+			lastNotOK = i
 		}
 	}
 	switch notOK {
@@ -180,6 +450,21 @@ func MakePipelineError(excs []*Exception) error {
 	}
 }
 
+// Appends excs to dst, replacing exceptions of nested pipelines with their
+// component exceptions and nil with OK.
+func flattenPipelineExceptions(dst, excs []*Exception) []*Exception {
+	for _, e := range excs {
+		if e == nil {
+			dst = append(dst, OK)
+		} else if pe, ok := e.Reason.(PipelineError); ok {
+			dst = flattenPipelineExceptions(dst, pe.Errors)
+		} else {
+			dst = append(dst, e)
+		}
+	}
+	return dst
+}
+
 func (pe PipelineError) Fields() vals.StructMap { return peFields{pe} }
 
 type peFields struct{ pe PipelineError }
@@ -231,6 +516,35 @@ func (flowFields) IsStructMap() {}
 func (f flowFields) Type() string { return "flow" }
 func (f flowFields) Name() string { return f.f.Error() }
 
+// FlowReturn is a special type of error used for returning from a function
+// with values. It is handled like Return, except that the values are output
+// by the function.
+type FlowReturn struct {
+	Values []interface{}
+}
+
+func (f FlowReturn) Error() string { return Return.Error() }
+
+// Show shows the flow "error".
+func (f FlowReturn) Show(indent string) string { return Return.Show(indent) }
+
+func (f FlowReturn) Fields() vals.StructMap { return flowReturnFields{f} }
+
+type flowReturnFields struct{ f FlowReturn }
+
+func (flowReturnFields) IsStructMap() {}
+
+func (f flowReturnFields) Type() string { return "flow" }
+func (f flowReturnFields) Name() string { return Return.Error() }
+
+func (f flowReturnFields) Values() vals.List {
+	li := vals.EmptyList
+	for _, v := range f.f.Values {
+		li = li.Cons(v)
+	}
+	return li
+}
+
 // ExternalCmdExit contains the exit status of external commands.
 type ExternalCmdExit struct {
 	syscall.WaitStatus
@@ -247,6 +561,36 @@ func NewExternalCmdExit(name string, ws syscall.WaitStatus, pid int) error {
 	return ExternalCmdExit{ws, name, pid}
 }
 
+// SignalName is used to name signals in the error message and fields of
+// ExternalCmdExit. The default implementation uses the conventional names like
+// "SIGKILL" for common signals, so that they are named consistently across
+// platforms, and falls back to the String method for other signals. It may be
+// replaced to customize the names.
+var SignalName = defaultSignalName
+
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGHUP:  "SIGHUP",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGQUIT: "SIGQUIT",
+	syscall.SIGILL:  "SIGILL",
+	syscall.SIGTRAP: "SIGTRAP",
+	syscall.SIGABRT: "SIGABRT",
+	syscall.SIGBUS:  "SIGBUS",
+	syscall.SIGFPE:  "SIGFPE",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGPIPE: "SIGPIPE",
+	syscall.SIGALRM: "SIGALRM",
+	syscall.SIGTERM: "SIGTERM",
+}
+
+func defaultSignalName(sig syscall.Signal) string {
+	if name, ok := signalNames[sig]; ok {
+		return name
+	}
+	return sig.String()
+}
+
 func (exit ExternalCmdExit) Error() string {
 	ws := exit.WaitStatus
 	quotedName := parse.Quote(exit.CmdName)
@@ -254,13 +598,13 @@ func (exit ExternalCmdExit) Error() string {
 	case ws.Exited():
 		return quotedName + " exited with " + strconv.Itoa(ws.ExitStatus())
 	case ws.Signaled():
-		causeDescription := quotedName + " killed by signal " + ws.Signal().String()
+		causeDescription := quotedName + " killed by signal " + SignalName(ws.Signal())
 		if ws.CoreDump() {
 			causeDescription += " (core dumped)"
 		}
 		return causeDescription
 	case ws.Stopped():
-		causeDescription := quotedName + " stopped by signal " + fmt.Sprintf("%s (pid=%d)", ws.StopSignal(), exit.Pid)
+		causeDescription := quotedName + " stopped by signal " + fmt.Sprintf("%s (pid=%d)", SignalName(ws.StopSignal()), exit.Pid)
 		trap := ws.TrapCause()
 		if trap != -1 {
 			causeDescription += fmt.Sprintf(" (trapped %v)", trap)
@@ -300,14 +644,14 @@ func (f exitFieldsExited) ExitStatus() string { return strconv.Itoa(f.e.ExitStat
 type exitFieldsSignaled struct{ exitFieldsCommon }
 
 func (f exitFieldsSignaled) Type() string         { return "external-cmd/signaled" }
-func (f exitFieldsSignaled) SignalName() string   { return f.e.Signal().String() }
+func (f exitFieldsSignaled) SignalName() string   { return SignalName(f.e.Signal()) }
 func (f exitFieldsSignaled) SignalNumber() string { return strconv.Itoa(int(f.e.Signal())) }
 func (f exitFieldsSignaled) CoreDumped() bool     { return f.e.CoreDump() }
 
 type exitFieldsStopped struct{ exitFieldsCommon }
 
 func (f exitFieldsStopped) Type() string         { return "external-cmd/stopped" }
-func (f exitFieldsStopped) SignalName() string   { return f.e.StopSignal().String() }
+func (f exitFieldsStopped) SignalName() string   { return SignalName(f.e.StopSignal()) }
 func (f exitFieldsStopped) SignalNumber() string { return strconv.Itoa(int(f.e.StopSignal())) }
 func (f exitFieldsStopped) TrapCause() int       { return f.e.TrapCause() }
 
@@ -1,17 +1,25 @@
 package eval_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
 	"runtime"
+	"strings"
 	"testing"
-	"unsafe"
 
 	"github.com/elves/elvish/pkg/diag"
 	. "github.com/elves/elvish/pkg/eval"
+	"github.com/elves/elvish/pkg/eval/errs"
 
 	. "github.com/elves/elvish/pkg/eval/evaltest"
 	"github.com/elves/elvish/pkg/eval/vals"
+	"github.com/elves/elvish/pkg/parse"
 	"github.com/elves/elvish/pkg/tt"
+	"github.com/elves/elvish/pkg/ui"
 	"github.com/xiaq/persistent/hash"
 )
 
@@ -29,9 +37,19 @@ func TestException(t *testing.T) {
 	vals.TestValue(t, exc).
 		Kind("exception").
 		Bool(false).
-		Hash(hash.Pointer(unsafe.Pointer(exc))).
+		Hash(hash.String("error")).
 		Equal(exc).
+		// Exceptions with equivalent reasons are equal, regardless of the
+		// tracebacks.
+		Equal(makeException(FailError{"error"},
+			diag.NewContext("a.elv", "fail error", diag.Ranging{From: 0, To: 10}))).
 		NotEqual(makeException(errors.New("error"))).
+		NotEqual(makeException(FailError{"another error"})).
+		// Wrapping the reason makes the exception different, even if the
+		// message stays the same.
+		NotEqual(makeException(fmt.Errorf("%w", err))).
+		NotEqual((*Exception)(nil)).
+		NotEqual(OK).
 		AllKeys("reason").
 		Index("reason", err).
 		IndexError("stack", vals.NoSuchKey("stack")).
@@ -40,7 +58,121 @@ func TestException(t *testing.T) {
 	vals.TestValue(t, OK).
 		Kind("exception").
 		Bool(true).
+		Hash(0).
+		Equal(&Exception{}).
+		NotEqual(exc).
 		Repr("$ok")
+
+	vals.TestValue(t, (*Exception)(nil)).
+		Hash(0).
+		Equal((*Exception)(nil)).
+		NotEqual(OK)
+}
+
+func TestException_ReprWithTraceback(t *testing.T) {
+	err := FailError{"error"}
+	exc := makeException(err,
+		diag.NewContext("a.elv", "echo\nfail error", diag.Ranging{From: 5, To: 15}),
+		diag.NewContext("b.elv", "a", diag.Ranging{From: 0, To: 1}))
+	tt.Test(t, tt.Fn("ReprWithTraceback", (*Exception).ReprWithTraceback), tt.Table{
+		tt.Args(exc, vals.NoPretty).Rets(
+			"[&reason=[&content=error &type=fail] &traceback=[a.elv:2:1 b.elv:1:1]]"),
+		// Without a traceback, the same as Repr.
+		tt.Args(makeException(err), vals.NoPretty).Rets(
+			"[&reason=[&content=error &type=fail]]"),
+		tt.Args(OK, vals.NoPretty).Rets("$ok"),
+	})
+	// Repr is not affected.
+	if got, want := exc.Repr(vals.NoPretty), "[&reason=[&content=error &type=fail]]"; got != want {
+		t.Errorf("Repr -> %q, want %q", got, want)
+	}
+}
+
+func TestException_Chain(t *testing.T) {
+	inner := diag.NewContext("inner.elv", "echo", diag.Ranging{From: 0, To: 4})
+	outer := diag.NewContext("outer.elv", "put", diag.Ranging{From: 0, To: 3})
+	reason := errors.New("error")
+
+	exc := WrapException(reason, inner)
+	parent := makeException(errors.New("parent error"), outer)
+	orig := exc.StackTrace
+	exc = exc.Chain(parent)
+
+	shown := exc.Show("")
+	innerIdx, outerIdx := strings.Index(shown, "inner.elv"), strings.Index(shown, "outer.elv")
+	if innerIdx == -1 || outerIdx == -1 || innerIdx > outerIdx {
+		t.Errorf("traceback doesn't show the inner then the outer context: %q", shown)
+	}
+	if strings.Contains(shown, "parent error") {
+		t.Errorf("traceback shows the reason of the parent: %q", shown)
+	}
+	// The stack traces of the original exception and the parent are not
+	// modified.
+	if orig.Next != nil {
+		t.Errorf("stack trace of exc modified")
+	}
+	if parent.StackTrace.Next != nil {
+		t.Errorf("stack trace of parent modified")
+	}
+
+	vals.TestValue(t, exc).
+		Bool(false).
+		Repr("[&reason=<unknown error>]")
+
+	// WrapException with no context and chaining with a nil parent.
+	exc = WrapException(reason, nil).Chain(nil)
+	if exc.Reason != reason || exc.StackTrace != nil {
+		t.Errorf("got %#v, want exception with only the reason", exc)
+	}
+
+	// Chaining OK doesn't modify it.
+	if chained := OK.Chain(parent); chained == OK || chained.StackTrace != parent.StackTrace {
+		t.Errorf("OK.Chain -> %#v, want a new exception with the parent's stack trace", chained)
+	}
+	if OK.Reason != nil || OK.StackTrace != nil {
+		t.Errorf("OK modified by Chain: %#v", OK)
+	}
+	if chained := (*Exception)(nil).Chain(parent); chained != nil {
+		t.Errorf("nil.Chain -> %#v, want nil", chained)
+	}
+}
+
+func TestNewException(t *testing.T) {
+	reason := errors.New("error")
+	var exc *Exception
+	ev := NewEvaler()
+	ev.Global.AddGoFn("", "f", func(fm *Frame) { exc = NewException(reason, fm) })
+	code := "fn g { f }; g"
+	op, err := ev.ParseAndCompile(parse.Source{Name: "[test]", Code: code}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ev.Eval(op, EvalCfg{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if exc == nil || exc.Reason != reason {
+		t.Fatalf("got %#v, want exception with reason %v", exc, reason)
+	}
+	var frames []string
+	for s := exc.StackTrace; s != nil; s = s.Next {
+		frames = append(frames,
+			s.Head.Name+" "+strings.TrimSpace(s.Head.Source[s.Head.From:s.Head.To]))
+	}
+	if want := []string{"[test] f", "[test] g"}; !reflect.DeepEqual(frames, want) {
+		t.Errorf("got frames %q, want %q", frames, want)
+	}
+
+	// Exceptions are not wrapped again.
+	if got := NewException(exc, nil); got != exc {
+		t.Errorf("NewException(exc) -> %v, want exc", got)
+	}
+	if got := NewException(nil, nil); got != nil {
+		t.Errorf("NewException(nil) -> %v, want nil", got)
+	}
+	if got := NewException(reason, nil); got.Reason != reason || got.StackTrace != nil {
+		t.Errorf("NewException(reason, nil) -> %#v, want exception without traceback", got)
+	}
 }
 
 func makeException(cause error, entries ...*diag.Context) *Exception {
@@ -51,9 +183,307 @@ func makeException(cause error, entries ...*diag.Context) *Exception {
 	return &Exception{cause, s}
 }
 
+func TestException_Unwrap(t *testing.T) {
+	reason := errors.New("reason")
+	if !errors.Is(makeException(reason), reason) {
+		t.Errorf("errors.Is doesn't match the reason")
+	}
+	if errors.Unwrap(OK) != nil {
+		t.Errorf("errors.Unwrap(OK) is not nil")
+	}
+
+	badCmd := "false"
+	if runtime.GOOS == "windows" {
+		badCmd = "cmd /c exit 1"
+	}
+	ev := NewEvaler()
+	op, err := ev.ParseAndCompile(parse.Source{Name: "[test]", Code: badCmd}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ev.Eval(op, EvalCfg{})
+	var exit ExternalCmdExit
+	if !errors.As(err, &exit) {
+		t.Fatalf("errors.As can't extract ExternalCmdExit from %v", err)
+	}
+	if exit.ExitStatus() != 1 {
+		t.Errorf("got exit status %v, want 1", exit.ExitStatus())
+	}
+}
+
+func TestException_Summary(t *testing.T) {
+	tt.Test(t, tt.Fn("Summary", (*Exception).Summary), tt.Table{
+		tt.Args(OK).Rets("ok"),
+		tt.Args(makeException(errors.New("division by zero"))).
+			Rets("division by zero"),
+		tt.Args(makeException(errors.New("division by zero"),
+			diag.NewContext("foo.elv", "echo\n  / 1 0", diag.Ranging{From: 7, To: 12}),
+			diag.NewContext("bar.elv", "use foo", diag.Ranging{From: 0, To: 7}))).
+			Rets("foo.elv:2:3: division by zero"),
+	})
+}
+
+func TestException_Show(t *testing.T) {
+	exc := makeException(errors.New("error"))
+	if got, want := exc.Show(""), "Exception: \033[1;31merror\033[m"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	defer func(s ui.Style) { ReasonStyle = s }(ReasonStyle)
+	ReasonStyle = ui.Style{Foreground: ui.Blue}
+	if got, want := exc.Show(""), "Exception: \033[34merror\033[m"; got != want {
+		t.Errorf("got %q with custom ReasonStyle, want %q", got, want)
+	}
+}
+
+// A reason with a multi-line message that implements diag.Shower.
+type multiLineError struct{}
+
+func (multiLineError) Error() string { return "line 1\nline 2" }
+
+func (multiLineError) Show(indent string) string {
+	return "line 1\n" + indent + "  line 2"
+}
+
+func TestException_Show_ShowerReason(t *testing.T) {
+	exc := makeException(multiLineError{})
+	if got, want := exc.Show(""), "Exception: line 1\n  line 2"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Nested exceptions pass their indentation to the Shower.
+	exc = makeException(PipelineError{[]*Exception{makeException(multiLineError{})}})
+	want := "Exception: \033[1;31m1 error in pipeline\033[m\n" +
+		"Caused by:\n" +
+		"  #0 Exception: line 1\n" +
+		"      line 2"
+	if got := exc.Show(""); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestException_ShowPlain(t *testing.T) {
+	exc := makeException(FailError{"error"},
+		diag.NewContext("a.elv", "echo\nfail error", diag.Ranging{From: 5, To: 15}),
+		diag.NewContext("b.elv", "a", diag.Ranging{From: 0, To: 1}))
+	colored, plain := exc.Show(""), exc.ShowPlain("")
+	if !strings.Contains(colored, "\033[") {
+		t.Errorf("Show -> %q, want escape sequences", colored)
+	}
+	if strings.Contains(plain, "\033") {
+		t.Errorf("ShowPlain -> %q, want no escape sequences", plain)
+	}
+	// The content is the same.
+	sgr := regexp.MustCompile("\033\\[[0-9;]*m")
+	if want := sgr.ReplaceAllString(colored, ""); plain != want {
+		t.Errorf("ShowPlain -> %q, want %q", plain, want)
+	}
+}
+
+func TestException_Code(t *testing.T) {
+	tt.Test(t, tt.Fn("Code", (*Exception).Code), tt.Table{
+		tt.Args(OK).Rets(""),
+		tt.Args(makeException(errors.New("error"))).Rets(""),
+		tt.Args(makeException(errs.OutOfRange{What: "index"})).Rets("out-of-range"),
+		tt.Args(makeException(errs.BadValue{What: "x"})).Rets("bad-value"),
+	})
+
+	exc := makeException(errs.BadValue{What: "x", Valid: "y", Actual: "z"})
+	if got, want := exc.Show(""),
+		"Exception: \033[1;31mbad value: x must be y, but is z\033[m [bad-value]"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestException_Code_Builtins(t *testing.T) {
+	tests := []struct {
+		code     string
+		wantCode string
+	}{
+		{"use non-existent", "no-such-module"},
+		{"ns [&[]=[]]", "bad-value"},
+		{"put [a b][2]", "out-of-range"},
+	}
+	for _, test := range tests {
+		ev := NewEvaler()
+		op, err := ev.ParseAndCompile(parse.Source{Name: "[test]", Code: test.code}, nil)
+		if err != nil {
+			t.Fatalf("compile %q: %v", test.code, err)
+		}
+		err = ev.Eval(op, EvalCfg{})
+		exc, ok := err.(*Exception)
+		if !ok {
+			t.Errorf("%q throws %v, want exception", test.code, err)
+			continue
+		}
+		if code := exc.Code(); code != test.wantCode {
+			t.Errorf("%q throws exception with code %q, want %q",
+				test.code, code, test.wantCode)
+		}
+	}
+}
+
+func TestException_Show_PipelineError(t *testing.T) {
+	exc := makeException(
+		PipelineError{[]*Exception{
+			makeException(errors.New("foo"),
+				diag.NewContext("a.elv", "fail foo", diag.Ranging{From: 0, To: 8}),
+				diag.NewContext("b.elv", "a | b", diag.Ranging{From: 0, To: 1})),
+			OK,
+			makeException(errors.New("bar"),
+				diag.NewContext("b.elv", "a | b", diag.Ranging{From: 4, To: 5})),
+		}},
+		diag.NewContext("b.elv", "a | b", diag.Ranging{From: 0, To: 5}))
+	want := "Exception: \033[1;31m2 errors in pipeline\033[m\n" +
+		"b.elv, line 1: \033[1;4ma | b\033[m\n" +
+		"Caused by:\n" +
+		"  #0 Exception: \033[1;31mfoo\033[m\n" +
+		"    Traceback:\n" +
+		"      a.elv, line 1:\n" +
+		"        \033[1;4mfail foo\033[m\n" +
+		"      b.elv, line 1:\n" +
+		"        \033[1;4ma\033[m | b\n" +
+		"  #2 Exception: \033[1;31mbar\033[m\n" +
+		"    b.elv, line 1: a | \033[1;4mb\033[m"
+	if got := exc.Show(""); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestException_Show_MaxTracebackFrames(t *testing.T) {
+	var frames []*diag.Context
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("frame%d.elv", i)
+		frames = append(frames, diag.NewContext(name, "echo", diag.Ranging{From: 0, To: 4}))
+	}
+	exc := makeException(errors.New("error"), frames...)
+
+	defer func(n int) { MaxTracebackFrames = n }(MaxTracebackFrames)
+	for _, test := range []struct {
+		max        int
+		wantShown  []int
+		wantElided string
+	}{
+		{0, []int{0, 1, 2, 3, 4}, ""},
+		{5, []int{0, 1, 2, 3, 4}, ""},
+		{3, []int{0, 1, 4}, "\n  … 2 more frames\n"},
+		{4, []int{0, 1, 2, 4}, "\n  … 1 more frame\n"},
+		{1, []int{0}, "\n  … 4 more frames"},
+	} {
+		MaxTracebackFrames = test.max
+		shown := exc.Show("")
+		for i := range frames {
+			name := fmt.Sprintf("frame%d.elv", i)
+			if got, want := strings.Contains(shown, name), contains(test.wantShown, i); got != want {
+				t.Errorf("with MaxTracebackFrames = %d, shows %s = %v, want %v",
+					test.max, name, got, want)
+			}
+		}
+		if hasElided := strings.Contains(shown, "more frame"); hasElided != (test.wantElided != "") ||
+			(hasElided && !strings.Contains(shown, test.wantElided)) {
+			t.Errorf("with MaxTracebackFrames = %d, got %q, want elision %q",
+				test.max, shown, test.wantElided)
+		}
+	}
+}
+
+func TestException_Show_FrameRenderer(t *testing.T) {
+	defer func(f func(*diag.Context, *bytes.Buffer, string)) { FrameRenderer = f }(FrameRenderer)
+	FrameRenderer = func(frame *diag.Context, buf *bytes.Buffer, indent string) {
+		line, col := frame.LineCol()
+		fmt.Fprintf(buf, "<%s:%d:%d>\n%s|", strings.TrimPrefix(frame.Name, "/long/prefix/"), line, col, indent)
+	}
+
+	ctx1 := diag.NewContext("/long/prefix/a.elv", "echo\n  f", diag.Ranging{From: 7, To: 8})
+	ctx2 := diag.NewContext("b.elv", "fail bad", diag.Ranging{From: 0, To: 8})
+	tests := []struct {
+		exc  *Exception
+		want string
+	}{
+		{makeException(errors.New("error"), ctx1),
+			"Exception: \033[1;31merror\033[m\n<a.elv:2:3>\n|"},
+		{makeException(errors.New("error"), ctx1, ctx2),
+			"Exception: \033[1;31merror\033[m\nTraceback:" +
+				"\n  <a.elv:2:3>\n    |" +
+				"\n  <b.elv:1:1>\n    |"},
+	}
+	for _, test := range tests {
+		if got := test.exc.Show(""); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+}
+
+func contains(is []int, i int) bool {
+	for _, j := range is {
+		if i == j {
+			return true
+		}
+	}
+	return false
+}
+
+func TestException_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		exc  *Exception
+		want string
+	}{
+		{OK, `{"reason":null,"traceback":[]}`},
+		{makeException(errors.New("error")),
+			`{"reason":"error","traceback":[]}`},
+		{makeException(FailError{"bad"},
+			diag.NewContext("a.elv", "fail bad", diag.Ranging{From: 0, To: 8}),
+			diag.NewContext("b.elv", "echo\n  f", diag.Ranging{From: 7, To: 8})),
+			`{"reason":"bad","fields":{"content":"bad","type":"fail"},` +
+				`"traceback":[{"name":"a.elv","line":1,"col":1},` +
+				`{"name":"b.elv","line":2,"col":3}]}`},
+		{makeException(ExternalCmdExit{CmdName: "false", WaitStatus: exitWaitStatus(1), Pid: 42}),
+			`{"reason":"false exited with 1",` +
+				`"fields":{"cmd-name":"false","exit-status":"1","pid":"42","type":"external-cmd/exited"},` +
+				`"traceback":[]}`},
+		{makeException(errs.OutOfRange{What: "index", ValidLow: "0", ValidHigh: "1", Actual: "2"}),
+			`{"reason":"out of range: index must be from 0 to 1, but is 2",` +
+				`"code":"out-of-range","traceback":[]}`},
+	}
+	for _, test := range tests {
+		data, err := json.Marshal(test.exc)
+		if err != nil {
+			t.Errorf("MarshalJSON of %v errors: %v", test.exc, err)
+			continue
+		}
+		// Compare the decoded values, since the order of fields is not
+		// guaranteed.
+		var got, want interface{}
+		json.Unmarshal(data, &got)
+		json.Unmarshal([]byte(test.want), &want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("MarshalJSON -> %s, want %s", data, test.want)
+		}
+	}
+}
+
+func TestException_Eq(t *testing.T) {
+	Test(t,
+		That("eq $ok $ok").Puts(true),
+		That("eq ?(nop) $ok").Puts(true),
+		That("eq ?(fail foo) $ok").Puts(false),
+		// Exceptions with the same reason are equal, even if raised from
+		// different places.
+		That("e = ?(fail foo); eq $e ?(fail foo)").Puts(true),
+		That("eq ?(fail foo) ?(fail bar)").Puts(false),
+		// The reasons must be of the same type.
+		That("eq ?(fail foo) ?(return)").Puts(false),
+		That("eq ?(return) ?(return)").Puts(true),
+		// Equal exceptions are the same map key.
+		That("m = [&]; m[?(fail foo)] = x; put $m[?(fail foo)]").Puts("x"),
+	)
+}
+
 func TestFlow_Fields(t *testing.T) {
 	Test(t,
 		That("put ?(return)[reason][type name]").Puts("flow", "return"),
+		That("put ?(return a)[reason][type name]").Puts("flow", "return"),
+		That("put ?(return a b)[reason][values][1]").Puts("b"),
 	)
 }
 
@@ -65,7 +495,8 @@ func TestExternalCmdExit_Fields(t *testing.T) {
 	Test(t,
 		That("put ?("+badCmd+")[reason][type exit-status]").
 			Puts("external-cmd/exited", "1"),
-		// TODO: Test killed and stopped commands
+		// Killed commands are tested in exception_unix_test.go.
+		// TODO: Test stopped commands
 	)
 }
 
@@ -75,18 +506,56 @@ func TestPipelineError_Fields(t *testing.T) {
 		That("count ?(fail 1 | fail 2)[reason][exceptions]").Puts("2"),
 		That("put ?(fail 1 | fail 2)[reason][exceptions][0][reason][type]").
 			Puts("fail"),
+		// Each component exception can be accessed, in the order of the
+		// commands in the pipeline.
+		That("each [e]{ put $e[reason][content] } ?(fail 1 | fail 2)[reason][exceptions]").
+			Puts("1", "2"),
+		// Commands that did not fail have $ok as their exception.
+		That("bool ?(fail 1 | nop | fail 3)[reason][exceptions][1]").Puts(true),
+		// Errors of nested pipelines are flattened.
+		That("each [e]{ put $e[reason][content] } "+
+			"?({ fail 1 | fail 2 } | fail 3)[reason][exceptions]").
+			Puts("1", "2", "3"),
 	)
 }
 
+func TestMakePipelineError(t *testing.T) {
+	err1 := makeException(errors.New("err1"))
+	err2 := makeException(errors.New("err2"))
+	err3 := makeException(errors.New("err3"))
+	tt.Test(t, tt.Fn("MakePipelineError", MakePipelineError), tt.Table{
+		tt.Args([]*Exception{nil, OK}).Rets(nil),
+		// A single error is returned as is.
+		tt.Args([]*Exception{nil, err1, OK}).Rets(err1),
+		tt.Args([]*Exception{err1, nil, err2}).Rets(
+			PipelineError{[]*Exception{err1, OK, err2}}),
+		// Nested pipeline errors are flattened.
+		tt.Args([]*Exception{
+			err1,
+			makeException(PipelineError{[]*Exception{
+				err2,
+				makeException(PipelineError{[]*Exception{OK, err3}})}}),
+		}).Rets(PipelineError{[]*Exception{err1, err2, OK, err3}}),
+		// A nested pipeline error with a single error is unwrapped.
+		tt.Args([]*Exception{
+			OK, makeException(PipelineError{[]*Exception{nil, err2}}),
+		}).Rets(err2),
+	})
+}
+
 func TestErrorMethods(t *testing.T) {
 	tt.Test(t, tt.Fn("Error", error.Error), tt.Table{
 		tt.Args(makeException(errors.New("err"))).Rets("err"),
 
 		tt.Args(MakePipelineError([]*Exception{
 			makeException(errors.New("err1")),
-			makeException(errors.New("err2"))})).Rets("(err1 | err2)"),
+			makeException(errors.New("err2"))})).Rets("(#0 err1 | #1 err2)"),
+		// Only the middle command failed.
+		tt.Args(PipelineError{[]*Exception{
+			OK, makeException(errors.New("err")), nil}}).Rets("(#0 <nil> | #1 err | #2 <nil>)"),
 
 		tt.Args(Return).Rets("return"),
+		tt.Args(FlowReturn{[]interface{}{"a"}}).Rets("return"),
 		tt.Args(Break).Rets("break"),
 		tt.Args(Continue).Rets("continue"),
 		tt.Args(Flow(1000)).Rets("!(BAD FLOW: 1000)"),
@@ -10,29 +10,59 @@ import (
 
 	. "github.com/elves/elvish/pkg/eval"
 
+	. "github.com/elves/elvish/pkg/eval/evaltest"
 	"github.com/elves/elvish/pkg/tt"
 )
 
+func TestExternalCmdExit_Fields_Signaled(t *testing.T) {
+	Test(t,
+		That("put ?(sh -c 'kill -9 $$')[reason][type signal-name signal-number]").
+			Puts("external-cmd/signaled", "SIGKILL", "9"),
+		That("put ?(sh -c 'kill -9 $$')[reason][core-dumped]").Puts(false),
+		That("put ?(sh -c 'kill -9 $$')[reason][cmd-name]").Puts("sh"),
+	)
+}
+
 func TestExternalCmdExit_Error(t *testing.T) {
 	tt.Test(t, tt.Fn("Error", error.Error), tt.Table{
 		tt.Args(ExternalCmdExit{0x0, "ls", 1}).Rets("ls exited with 0"),
 		tt.Args(ExternalCmdExit{0x100, "ls", 1}).Rets("ls exited with 1"),
-		// Note: all Unix'es have SIGINT = 2, but syscall package has different
-		// string in gccgo("Interrupt") and gc("interrupt").
-		tt.Args(ExternalCmdExit{0x2, "ls", 1}).Rets("ls killed by signal " + syscall.SIGINT.String()),
+		// Note: all Unix'es have SIGINT = 2.
+		tt.Args(ExternalCmdExit{0x2, "ls", 1}).Rets("ls killed by signal SIGINT"),
 		// 0x80 + signal for core dumped
-		tt.Args(ExternalCmdExit{0x82, "ls", 1}).Rets("ls killed by signal " + syscall.SIGINT.String() + " (core dumped)"),
+		tt.Args(ExternalCmdExit{0x82, "ls", 1}).Rets("ls killed by signal SIGINT (core dumped)"),
 		// 0x7f + signal<<8 for stopped
-		tt.Args(ExternalCmdExit{0x27f, "ls", 1}).Rets("ls stopped by signal " + syscall.SIGINT.String() + " (pid=1)"),
+		tt.Args(ExternalCmdExit{0x27f, "ls", 1}).Rets("ls stopped by signal SIGINT (pid=1)"),
 	})
 	if runtime.GOOS == "linux" {
 		tt.Test(t, tt.Fn("Error", error.Error), tt.Table{
-			// 0x057f + cause<<16 for trapped. SIGTRAP is 5 on all Unix'es but have
-			// different string representations on different OSes.
-			tt.Args(ExternalCmdExit{0x1057f, "ls", 1}).Rets(fmt.Sprintf(
-				"ls stopped by signal %s (pid=1) (trapped 1)", syscall.SIGTRAP)),
+			// 0x057f + cause<<16 for trapped. SIGTRAP is 5 on all Unix'es.
+			tt.Args(ExternalCmdExit{0x1057f, "ls", 1}).Rets(
+				"ls stopped by signal SIGTRAP (pid=1) (trapped 1)"),
 			// 0xff is the only exit code that is not exited, signaled or stopped.
 			tt.Args(ExternalCmdExit{0xff, "ls", 1}).Rets("ls has unknown WaitStatus 255"),
 		})
 	}
 }
+
+func TestExternalCmdExit_Error_SignalName(t *testing.T) {
+	tt.Test(t, tt.Fn("Error", error.Error), tt.Table{
+		tt.Args(fakeExternalCmdExit("ls", syscall.SIGKILL)).Rets("ls killed by signal SIGKILL"),
+		tt.Args(fakeExternalCmdExit("ls", syscall.SIGSEGV)).Rets("ls killed by signal SIGSEGV"),
+	})
+}
+
+func TestExternalCmdExit_Error_CustomSignalName(t *testing.T) {
+	saved := SignalName
+	defer func() { SignalName = saved }()
+	SignalName = func(sig syscall.Signal) string { return fmt.Sprint("signal ", int(sig)) }
+
+	tt.Test(t, tt.Fn("Error", error.Error), tt.Table{
+		tt.Args(fakeExternalCmdExit("ls", syscall.SIGKILL)).Rets("ls killed by signal signal 9"),
+	})
+}
+
+// Returns an ExternalCmdExit for a command killed by the given signal.
+func fakeExternalCmdExit(name string, sig syscall.Signal) ExternalCmdExit {
+	return ExternalCmdExit{syscall.WaitStatus(sig), name, 1}
+}
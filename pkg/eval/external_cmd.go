@@ -94,5 +94,9 @@ func (e ExternalCmd) Call(fm *Frame, argVals []interface{}, opts map[string]inte
 		// calling `Wait` twice on a particular process object.
 		return err
 	}
-	return NewExternalCmdExit(e.Name, state.Sys().(syscall.WaitStatus), proc.Pid)
+	ws := state.Sys().(syscall.WaitStatus)
+	if ws.Exited() && fm.state.isAllowedExitCode(ws.ExitStatus()) {
+		return nil
+	}
+	return NewExternalCmdExit(e.Name, ws, proc.Pid)
 }
@@ -36,3 +36,13 @@ func TestBuiltinFnExternal(t *testing.T) {
 		That(`e = (external true); E:PATH=/ $e`).Throws(AnyError),
 	)
 }
+
+func TestBuiltinFnExternal_AllowedExitCodes(t *testing.T) {
+	TestWithSetup(t, func(ev *Evaler) { ev.SetAllowedExitCodes(1) },
+		That(`e = (external false); $e`).DoesNothing(),
+	)
+	TestWithSetup(t, func(ev *Evaler) { ev.SetAllowedExitCodes(2) },
+		That(`e = (external false); $e`).Throws(CmdExit(
+			ExternalCmdExit{CmdName: "false", WaitStatus: exitWaitStatus(1)})),
+	)
+}
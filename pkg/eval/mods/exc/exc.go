@@ -0,0 +1,157 @@
+// Package exc exposes functionality for working with exceptions as an Elvish
+// module.
+package exc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/elves/elvish/pkg/diag"
+	"github.com/elves/elvish/pkg/eval"
+	"github.com/elves/elvish/pkg/eval/vals"
+)
+
+//elvdoc:fn cause
+//
+// ```elvish
+// exc:cause $exception
+// ```
+//
+// Outputs the cause of `$exception`. If the exception was thrown by a
+// pipeline in which multiple commands threw, outputs a list of the causes
+// of the exceptions of all the commands instead. Outputs `$nil` if `$exception` is
+// `$ok`.
+//
+// ```elvish-transcript
+// ~> exc:cause ?(fail foo)
+// ▶ [&content=foo &type=fail]
+// ~> exc:cause ?(fail foo | fail bar)
+// ▶ [[&content=foo &type=fail] [&content=bar &type=fail]]
+// ~> exc:cause $ok
+// ▶ $nil
+// ```
+
+//elvdoc:fn to-map
+//
+// ```elvish
+// exc:to-map $exception
+// ```
+//
+// Outputs a map describing `$exception`, with the following keys:
+//
+// -   `cause` is the same as the output of [`exc:cause`](#exccause).
+//
+// -   `traceback` is a list of strings of the form `name:line:col`, one for
+//     each frame of the stack trace, innermost first.
+//
+// -   `exit` only exists when the exception was thrown by an external command
+//     that didn't exit successfully, and is a map with the details of the exit,
+//     like `type`, `exit-status` and `signal-name`.
+//
+// -   `code` only exists when the cause has a code, like that of exceptions
+//     thrown by [`fail-with-code`](builtin.html#fail-with-code), and is the
+//     code as a string.
+//
+// Outputs an empty map if `$exception` is `$ok`.
+//
+// ```elvish-transcript
+// ~> keys (exc:to-map ?(fail foo))
+// ▶ cause
+// ▶ traceback
+// ~> exc:to-map $ok
+// ▶ [&]
+// ```
+
+//elvdoc:fn traceback
+//
+// ```elvish
+// exc:traceback $exception
+// ```
+//
+// Outputs a list of maps describing the frames of the stack trace of
+// `$exception`, innermost first. Each map has the following keys:
+//
+// -   `name` is the name of the source, like a file name.
+//
+// -   `line` and `col` are the line and column numbers where the code of the
+//     frame starts, both starting from 1.
+//
+// -   `text` is the code of the frame, with surrounding whitespace removed.
+//
+// Outputs an empty list if `$exception` is `$ok`.
+//
+// ```elvish-transcript
+// ~> fn f { fail foo }
+// ~> each [frame]{ echo $frame[line]:$frame[text] } (exc:traceback ?(f))
+// 1:fail foo
+// 1:f
+// ```
+
+var fns = map[string]interface{}{
+	"cause":     cause,
+	"to-map":    toMap,
+	"traceback": traceback,
+}
+
+func cause(e *eval.Exception) interface{} {
+	switch reason := e.Reason.(type) {
+	case nil:
+		return nil
+	case eval.PipelineError:
+		li := vals.EmptyList
+		for _, exc := range reason.Errors {
+			li = li.Cons(exc.Reason)
+		}
+		return li
+	default:
+		return reason
+	}
+}
+
+func toMap(e *eval.Exception) vals.Map {
+	m := vals.EmptyMap
+	if e.Reason == nil {
+		return m
+	}
+	traceback := vals.EmptyList
+	for tb := e.StackTrace; tb != nil; tb = tb.Next {
+		line, col := tb.Head.LineCol()
+		traceback = traceback.Cons(fmt.Sprintf("%s:%d:%d", tb.Head.Name, line, col))
+	}
+	m = m.Assoc("cause", cause(e)).Assoc("traceback", traceback)
+	var exit eval.ExternalCmdExit
+	if errors.As(e.Reason, &exit) {
+		m = m.Assoc("exit", exit.Fields())
+	}
+	if code := e.Code(); code != "" {
+		m = m.Assoc("code", code)
+	}
+	return m
+}
+
+func traceback(e *eval.Exception) vals.List {
+	frames := vals.EmptyList
+	for tb := e.StackTrace; tb != nil; tb = tb.Next {
+		ctx := tb.Head
+		line, col := ctx.LineCol()
+		frames = frames.Cons(vals.MakeMap(
+			"name", ctx.Name,
+			"line", strconv.Itoa(line),
+			"col", strconv.Itoa(col),
+			"text", frameText(ctx)))
+	}
+	return frames
+}
+
+// Returns the code of the frame with surrounding whitespace removed, or an
+// empty string if the frame has an unknown or invalid position.
+func frameText(ctx *diag.Context) string {
+	if ctx.From < 0 || ctx.To > len(ctx.Source) || ctx.From > ctx.To {
+		return ""
+	}
+	return strings.TrimSpace(ctx.Source[ctx.From:ctx.To])
+}
+
+var Ns = eval.Ns{}.AddGoFns("exc:", fns)
@@ -0,0 +1,57 @@
+package exc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/elves/elvish/pkg/diag"
+	"github.com/elves/elvish/pkg/eval"
+	. "github.com/elves/elvish/pkg/eval/evaltest"
+	"github.com/elves/elvish/pkg/eval/vals"
+)
+
+func TestExc(t *testing.T) {
+	setup := func(ev *eval.Evaler) { ev.Builtin.AddNs("exc", Ns) }
+	TestWithSetup(t, setup,
+		That(`exc:cause ?(fail foo)`).Puts(eval.FailError{Content: "foo"}),
+		That(`put (exc:cause ?(fail foo))[content]`).Puts("foo"),
+		That(`exc:cause $ok`).Puts(nil),
+		That(`count (exc:cause ?(fail foo | fail bar))`).Puts("2"),
+		That(`put (exc:cause ?(fail foo | fail bar))[0]`).
+			Puts(eval.FailError{Content: "foo"}),
+		That(`put (exc:cause ?(fail foo | fail bar))[1][content]`).Puts("bar"),
+		That(`exc:cause foo`).Throws(AnyError),
+
+		That(`put (exc:to-map ?(fail foo))[cause][content]`).Puts("foo"),
+		That(`put (exc:to-map ?(fail foo))[traceback][0]`).Puts("[test]:1:19"),
+		That(`has-key (exc:to-map ?(fail foo)) exit`).Puts(false),
+		That(`has-key (exc:to-map ?(fail foo)) code`).Puts(false),
+		That(`put (exc:to-map ?(fail-with-code bad-thing foo))[code]`).
+			Puts("bad-thing"),
+		That(`put (exc:to-map ?(fail-with-code bad-thing foo))[cause][content]`).
+			Puts("foo"),
+		That(`count (exc:to-map $ok)`).Puts("0"),
+		That(`exc:to-map foo`).Throws(AnyError),
+
+		That(`fn f { fail foo }; put (count (exc:traceback ?(f)))`).Puts("2"),
+		That(`fn f { fail foo }; each [frame]{
+				put $frame[name] $frame[line] $frame[col] $frame[text]
+			} (exc:traceback ?(f))`).
+			Puts("[test]", "1", "8", "fail foo", "[test]", "3", "23", "f"),
+		That(`put (exc:traceback ?(fail foo))[0][text]`).Puts("fail foo"),
+		That(`count (exc:traceback $ok)`).Puts("0"),
+		That(`exc:traceback foo`).Throws(AnyError),
+	)
+}
+
+func TestTraceback_InvalidPosition(t *testing.T) {
+	for _, r := range []diag.Ranging{{From: -1, To: -1}, {From: 2, To: 10}, {From: 3, To: 1}} {
+		e := &eval.Exception{Reason: errors.New("foo"), StackTrace: &eval.StackTrace{
+			Head: &diag.Context{Name: "[test]", Source: "echo", Ranging: r}}}
+		frame, _ := traceback(e).Index(0)
+		text, _ := vals.Index(frame, "text")
+		if text != "" {
+			t.Errorf("text of frame with range %v is %q, want empty", r, text)
+		}
+	}
+}
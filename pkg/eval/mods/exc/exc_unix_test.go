@@ -0,0 +1,18 @@
+// +build !windows,!plan9,!js
+
+package exc
+
+import (
+	"testing"
+
+	"github.com/elves/elvish/pkg/eval"
+	. "github.com/elves/elvish/pkg/eval/evaltest"
+)
+
+func TestToMap_ExternalCmdExit(t *testing.T) {
+	setup := func(ev *eval.Evaler) { ev.Builtin.AddNs("exc", Ns) }
+	TestWithSetup(t, setup,
+		That(`put (exc:to-map ?(false))[exit][type]`).Puts("external-cmd/exited"),
+		That(`put (exc:to-map ?(false))[exit][exit-status]`).Puts("1"),
+	)
+}
@@ -11,6 +11,8 @@ type state struct {
 	notifyBgJobSuccess bool
 	// The current number of background jobs.
 	numBgJobs int
+	// Non-zero exit codes of external commands that are not errors.
+	allowedExitCodes []int
 }
 
 func (s *state) getValuePrefix() string {
@@ -25,6 +27,17 @@ func (s *state) getNotifyBgJobSuccess() bool {
 	return s.notifyBgJobSuccess
 }
 
+func (s *state) isAllowedExitCode(code int) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, allowed := range s.allowedExitCodes {
+		if code == allowed {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *state) getNumBgJobs() int {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
@@ -2,10 +2,12 @@ package shell
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 
+	"github.com/elves/elvish/pkg/eval"
 	"github.com/elves/elvish/pkg/strutil"
 )
 
@@ -13,6 +15,23 @@ type editor interface {
 	ReadCode() (string, error)
 }
 
+// An editor that can record the exit status of the last command it has read.
+type exitStatusRecorder interface {
+	RecordExitStatus(status int) error
+}
+
+// Returns the exit status of a command that has finished with the given error.
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exit eval.ExternalCmdExit
+	if errors.As(err, &exit) && exit.Exited() {
+		return exit.ExitStatus()
+	}
+	return 1
+}
+
 type minEditor struct {
 	in  *bufio.Reader
 	out io.Writer
@@ -0,0 +1,30 @@
+package shell
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/elves/elvish/pkg/eval"
+)
+
+func TestExitStatus(t *testing.T) {
+	if got := exitStatus(nil); got != 0 {
+		t.Errorf("exitStatus(nil) -> %v, want 0", got)
+	}
+	if got := exitStatus(errors.New("error")); got != 1 {
+		t.Errorf("exitStatus(non-exit error) -> %v, want 1", got)
+	}
+
+	if runtime.GOOS == "windows" {
+		t.Skip("sh not available")
+	}
+	err := exec.Command("sh", "-c", "exit 3").Run()
+	ws := err.(*exec.ExitError).Sys().(syscall.WaitStatus)
+	exc := &eval.Exception{Reason: eval.NewExternalCmdExit("sh", ws, 0)}
+	if got := exitStatus(exc); got != 3 {
+		t.Errorf("exitStatus(exit 3) -> %v, want 3", got)
+	}
+}
@@ -109,6 +109,10 @@ func Interact(fds [3]*os.File, cfg *InteractConfig) {
 		if err != nil {
 			diag.ShowError(fds[2], err)
 		}
+		if recorder, ok := ed.(exitStatusRecorder); ok {
+			recorder.RecordExitStatus(exitStatus(err))
+			// TODO: Handle the error.
+		}
 	}
 }
 
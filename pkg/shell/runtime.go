@@ -11,6 +11,7 @@ import (
 	"github.com/elves/elvish/pkg/daemon"
 	"github.com/elves/elvish/pkg/eval"
 	daemonmod "github.com/elves/elvish/pkg/eval/mods/daemon"
+	"github.com/elves/elvish/pkg/eval/mods/exc"
 	mathmod "github.com/elves/elvish/pkg/eval/mods/math"
 	"github.com/elves/elvish/pkg/eval/mods/platform"
 	"github.com/elves/elvish/pkg/eval/mods/re"
@@ -49,6 +50,7 @@ var errInvalidDB = errors.New("daemon reported that database is invalid. If you
 func InitRuntime(stderr io.Writer, p Paths, spawn bool) *eval.Evaler {
 	ev := eval.NewEvaler()
 	ev.SetLibDir(p.LibDir)
+	ev.InstallModule("exc", exc.Ns)
 	ev.InstallModule("math", mathmod.Ns)
 	ev.InstallModule("platform", platform.Ns)
 	ev.InstallModule("re", re.Ns)
@@ -1,9 +1,11 @@
 package store
 
 const (
-	bucketCmd       = "cmd"
-	bucketDir       = "dir"
-	bucketSharedVar = "shared_var"
+	bucketCmd           = "cmd"
+	bucketCmdExitStatus = "cmd_exit_status"
+	bucketDir           = "dir"
+	bucketSharedVar     = "shared_var"
+	bucketMeta          = "meta"
 )
 
 // The following buckets were used before and are thus reserved:
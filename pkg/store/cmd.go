@@ -3,6 +3,7 @@ package store
 import (
 	"bytes"
 	"encoding/binary"
+	"strconv"
 
 	bolt "go.etcd.io/bbolt"
 )
@@ -12,6 +13,13 @@ func init() {
 		_, err := tx.CreateBucketIfNotExists([]byte(bucketCmd))
 		return err
 	}
+	// The exit statuses of commands are kept in a separate table, keyed by the
+	// sequence number of the command in the command history table. Commands
+	// without a recorded exit status are not in this table.
+	initDB["initialize command exit status table"] = func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucketCmdExitStatus))
+		return err
+	}
 }
 
 // NextCmdSeq returns the next sequence number of the command history.
@@ -45,8 +53,25 @@ func (s *dbStore) AddCmd(cmd string) (int, error) {
 // DelCmd deletes a command history item with the given sequence number.
 func (s *dbStore) DelCmd(seq int) error {
 	return s.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucketCmd))
-		return b.Delete(marshalSeq(uint64(seq)))
+		key := marshalSeq(uint64(seq))
+		err := tx.Bucket([]byte(bucketCmdExitStatus)).Delete(key)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(bucketCmd)).Delete(key)
+	})
+}
+
+// SetCmdExitStatus records the exit status of the command with the given
+// sequence number.
+func (s *dbStore) SetCmdExitStatus(seq, status int) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		key := marshalSeq(uint64(seq))
+		if tx.Bucket([]byte(bucketCmd)).Get(key) == nil {
+			return ErrNoMatchingCmd
+		}
+		b := tx.Bucket([]byte(bucketCmdExitStatus))
+		return b.Put(key, []byte(strconv.Itoa(status)))
 	})
 }
 
@@ -98,6 +123,27 @@ func (s *dbStore) CmdsWithSeq(from, upto int) ([]Cmd, error) {
 	return cmds, err
 }
 
+// FailedCmds returns all commands within the specified range that have a
+// recorded non-zero exit status.
+func (s *dbStore) FailedCmds(from, upto int) ([]Cmd, error) {
+	var cmds []Cmd
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketCmd))
+		statuses := tx.Bucket([]byte(bucketCmdExitStatus))
+		c := statuses.Cursor()
+		for k, v := c.Seek(marshalSeq(uint64(from))); k != nil && unmarshalSeq(k) < uint64(upto); k, v = c.Next() {
+			if string(v) == "0" {
+				continue
+			}
+			if text := b.Get(k); text != nil {
+				cmds = append(cmds, Cmd{Text: string(text), Seq: int(unmarshalSeq(k))})
+			}
+		}
+		return nil
+	})
+	return cmds, err
+}
+
 // NextCmd finds the first command after the given sequence number (inclusive)
 // with the given prefix.
 func (s *dbStore) NextCmd(from int, prefix string) (Cmd, error) {
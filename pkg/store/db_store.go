@@ -21,6 +21,9 @@ var initDB = map[string](func(*bolt.Tx) error){}
 type DBStore interface {
 	Store
 
+	SchemaVersion() (int, error)
+	Migrate(to int) error
+
 	Waits() *sync.WaitGroup
 	Close() error
 }
@@ -58,12 +61,31 @@ func NewStoreFromDB(db *bolt.DB) (DBStore, error) {
 	}
 
 	err := db.Update(func(tx *bolt.Tx) error {
+		// A database without any buckets is new, and uses the current schema.
+		fresh, _ := tx.Cursor().First()
 		for name, fn := range initDB {
 			err := fn(tx)
 			if err != nil {
 				return fmt.Errorf("failed to %s: %v", name, err)
 			}
 		}
+		if fresh == nil {
+			return setSchemaVersion(tx, SchemaVersion)
+		}
+		version, err := schemaVersion(tx)
+		if err != nil {
+			return fmt.Errorf("failed to read schema version: %v", err)
+		}
+		if version > SchemaVersion {
+			// Written by a newer version of Elvish; leave it alone.
+			logger.Printf("schema version %d is newer than %d", version, SchemaVersion)
+			return nil
+		}
+		err = migrate(tx, SchemaVersion)
+		if err != nil {
+			return fmt.Errorf("failed to migrate to schema version %d: %v",
+				SchemaVersion, err)
+		}
 		return nil
 	})
 	return st, err
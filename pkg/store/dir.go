@@ -1,19 +1,28 @@
 package store
 
 import (
+	"errors"
 	"sort"
 	"strconv"
 
 	bolt "go.etcd.io/bbolt"
 )
 
-// Parameters for directory history scores.
+// Parameters for directory history scores. Scores only decay when a directory
+// is added or DecayScores is called, never with the passage of time, so the
+// store doesn't read the clock.
 const (
 	DirScoreDecay     = 0.986 // roughly 0.5^(1/50)
 	DirScoreIncrement = 10
 	DirScorePrecision = 6
+	// Scores below this are truncated to zero by DecayScores.
+	DirScoreMin = 0.01
 )
 
+// ErrBadDecayFactor is returned by DecayScores when the factor is not between
+// 0 and 1.
+var ErrBadDecayFactor = errors.New("decay factor must be between 0 and 1")
+
 func init() {
 	initDB["initialize directory history table"] = func(tx *bolt.Tx) error {
 		_, err := tx.CreateBucketIfNotExists([]byte(bucketDir))
@@ -51,6 +60,31 @@ func (s *dbStore) AddDir(d string, incFactor float64) error {
 	})
 }
 
+// DecayScores multiplies the scores of all directories in the directory history
+// by factor, which must be between 0 and 1. Scores that become lower than
+// DirScoreMin are truncated to zero.
+func (s *dbStore) DecayScores(factor float64) error {
+	if factor < 0 || factor > 1 {
+		return ErrBadDecayFactor
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketDir))
+
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			score := unmarshalScore(v) * factor
+			if score < DirScoreMin {
+				score = 0
+			}
+			err := b.Put(k, marshalScore(score))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // AddDir adds a directory and its score to history.
 func (s *dbStore) AddDirRaw(d string, score float64) error {
 	return s.db.Update(func(tx *bolt.Tx) error {
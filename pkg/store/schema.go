@@ -0,0 +1,85 @@
+package store
+
+import (
+	"errors"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// SchemaVersion is the version of the database schema used by this version of
+// Elvish.
+//
+// Version 0 are databases created before the schema version was recorded.
+// Version 1 has the same layout, with the schema version recorded.
+const SchemaVersion = 1
+
+// ErrBadSchemaVersion is returned by Migrate when the database cannot be
+// migrated to the requested schema version.
+var ErrBadSchemaVersion = errors.New("unsupported schema version")
+
+const keySchemaVersion = "schema_version"
+
+// Migrations between schema versions; migrations[i] migrates a database from
+// version i to version i+1.
+var migrations = [SchemaVersion]func(*bolt.Tx) error{
+	// The layout did not change from version 0 to 1.
+	func(*bolt.Tx) error { return nil },
+}
+
+func init() {
+	initDB["initialize meta table"] = func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucketMeta))
+		return err
+	}
+}
+
+// SchemaVersion returns the schema version of the database.
+func (s *dbStore) SchemaVersion() (int, error) {
+	var version int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		version, err = schemaVersion(tx)
+		return err
+	})
+	return version, err
+}
+
+// Migrate migrates the database to the given schema version. Migrating to an
+// older version than the current one is not supported.
+func (s *dbStore) Migrate(to int) error {
+	return s.db.Update(func(tx *bolt.Tx) error { return migrate(tx, to) })
+}
+
+func migrate(tx *bolt.Tx, to int) error {
+	if to > SchemaVersion {
+		return ErrBadSchemaVersion
+	}
+	from, err := schemaVersion(tx)
+	if err != nil {
+		return err
+	}
+	if to < from {
+		return ErrBadSchemaVersion
+	}
+	for v := from; v < to; v++ {
+		err := migrations[v](tx)
+		if err != nil {
+			return err
+		}
+	}
+	return setSchemaVersion(tx, to)
+}
+
+func schemaVersion(tx *bolt.Tx) (int, error) {
+	v := tx.Bucket([]byte(bucketMeta)).Get([]byte(keySchemaVersion))
+	if v == nil {
+		return 0, nil
+	}
+	return strconv.Atoi(string(v))
+}
+
+func setSchemaVersion(tx *bolt.Tx, version int) error {
+	b := tx.Bucket([]byte(bucketMeta))
+	return b.Put([]byte(keySchemaVersion), []byte(strconv.Itoa(version)))
+}
@@ -0,0 +1,88 @@
+package store_test
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/elves/elvish/pkg/store"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestSchemaVersion_NewStore(t *testing.T) {
+	tStore, cleanup := store.MustGetTempStore()
+	defer cleanup()
+
+	version, err := tStore.SchemaVersion()
+	if version != store.SchemaVersion || err != nil {
+		t.Errorf("SchemaVersion() -> (%v, %v), want (%v, nil)",
+			version, err, store.SchemaVersion)
+	}
+}
+
+func TestNewStore_MigratesOldStore(t *testing.T) {
+	// Simulate a database created before schema versions were recorded, which
+	// has neither the meta bucket nor the schema version key.
+	f, err := ioutil.TempFile("", "elvish.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	db, err := bolt.Open(f.Name(), 0644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("dir"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("/usr"), []byte("1.000000E+01"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	tStore, err := store.NewStore(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tStore.Close()
+
+	wantDirs := []store.Dir{{Path: "/usr", Score: 10}}
+	testDirs := func() {
+		t.Helper()
+		dirs, err := tStore.Dirs(store.NoBlacklist)
+		if !reflect.DeepEqual(dirs, wantDirs) || err != nil {
+			t.Errorf("Dirs() -> (%v, %v), want (%v, nil)", dirs, err, wantDirs)
+		}
+	}
+	testVersion := func(want int) {
+		t.Helper()
+		version, err := tStore.SchemaVersion()
+		if version != want || err != nil {
+			t.Errorf("SchemaVersion() -> (%v, %v), want (%v, nil)",
+				version, err, want)
+		}
+	}
+
+	// Opening the store migrates it to the current schema version, keeping the
+	// data.
+	testVersion(store.SchemaVersion)
+	testDirs()
+
+	if err := tStore.Migrate(store.SchemaVersion + 1); err != store.ErrBadSchemaVersion {
+		t.Errorf("Migrate to a future version -> %v, want ErrBadSchemaVersion", err)
+	}
+	if err := tStore.Migrate(store.SchemaVersion); err != nil {
+		t.Errorf("Migrate to the current version -> %v, want nil", err)
+	}
+	if err := tStore.Migrate(0); err != store.ErrBadSchemaVersion {
+		t.Errorf("Migrate to an older version -> %v, want ErrBadSchemaVersion", err)
+	}
+	testVersion(store.SchemaVersion)
+	testDirs()
+}
@@ -18,11 +18,14 @@ type Store interface {
 	Cmd(seq int) (string, error)
 	Cmds(from, upto int) ([]string, error)
 	CmdsWithSeq(from, upto int) ([]Cmd, error)
+	SetCmdExitStatus(seq, status int) error
+	FailedCmds(from, upto int) ([]Cmd, error)
 	NextCmd(from int, prefix string) (Cmd, error)
 	PrevCmd(upto int, prefix string) (Cmd, error)
 
 	AddDir(dir string, incFactor float64) error
 	DelDir(dir string) error
+	DecayScores(factor float64) error
 	Dirs(blacklist map[string]struct{}) ([]Dir, error)
 
 	SharedVar(name string) (string, error)
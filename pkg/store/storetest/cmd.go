@@ -1,6 +1,7 @@
 package storetest
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/elves/elvish/pkg/store"
@@ -73,6 +74,24 @@ func TestCmd(t *testing.T, tStore store.Store) {
 		}
 	}
 
+	// Only commands with a recorded non-zero exit status are failed.
+	for seq, status := range map[int]int{1: 0, 2: 1, 4: 127} {
+		if err := tStore.SetCmdExitStatus(seq, status); err != nil {
+			t.Errorf("tStore.SetCmdExitStatus(%v, %v) => %v, want nil",
+				seq, status, err)
+		}
+	}
+	if err := tStore.SetCmdExitStatus(100, 1); !matchErr(err, store.ErrNoMatchingCmd) {
+		t.Errorf("tStore.SetCmdExitStatus(100, 1) => %v, want %v",
+			err, store.ErrNoMatchingCmd)
+	}
+	failedCmds, err := tStore.FailedCmds(startSeq, endSeq)
+	wantFailedCmds := []store.Cmd{{Text: "put bar", Seq: 2}, {Text: "echo bar", Seq: 4}}
+	if !reflect.DeepEqual(failedCmds, wantFailedCmds) || err != nil {
+		t.Errorf("tStore.FailedCmds(%v, %v) => (%v, %v), want (%v, nil)",
+			startSeq, endSeq, failedCmds, err, wantFailedCmds)
+	}
+
 	if err := tStore.DelCmd(1); err != nil {
 		t.Error("Failed to remove cmd")
 	}
@@ -27,6 +27,26 @@ var (
 			Score: store.DirScoreIncrement * store.DirScoreDecay,
 		},
 	}
+	wantedDirsAfterDecay = []store.Dir{
+		{
+			Path:  "/usr/bin",
+			Score: store.DirScoreIncrement * store.DirScoreDecay * store.DirScoreDecay * 0.5,
+		},
+		{
+			Path:  "/tmp",
+			Score: store.DirScoreMin,
+		},
+	}
+	wantedDirsAfterDecayTwice = []store.Dir{
+		{
+			Path:  "/usr/bin",
+			Score: store.DirScoreIncrement * store.DirScoreDecay * store.DirScoreDecay * 0.25,
+		},
+		{
+			Path:  "/tmp",
+			Score: 0,
+		},
+	}
 )
 
 // TestDir tests the directory history functionality of a Store.
@@ -50,4 +70,29 @@ func TestDir(t *testing.T, tStore store.Store) {
 		t.Errorf(`After DelDir("/usr"), tStore.ListDirs() => (%v, %v), want (%v, <nil>)`,
 			dirs, err, wantedDirsAfterDel)
 	}
+
+	tStore.AddDir("/tmp", store.DirScoreMin*2/store.DirScoreIncrement)
+	err = tStore.DecayScores(0.5)
+	if err != nil {
+		t.Errorf("tStore.DecayScores(0.5) => %v, want <nil>", err)
+	}
+	dirs, err = tStore.Dirs(black)
+	if err != nil || !reflect.DeepEqual(dirs, wantedDirsAfterDecay) {
+		t.Errorf(`After DecayScores(0.5), tStore.ListDirs() => (%v, %v), want (%v, <nil>)`,
+			dirs, err, wantedDirsAfterDecay)
+	}
+	// Scores below DirScoreMin are truncated to zero.
+	tStore.DecayScores(0.5)
+	dirs, err = tStore.Dirs(black)
+	if err != nil || !reflect.DeepEqual(dirs, wantedDirsAfterDecayTwice) {
+		t.Errorf(`After DecayScores(0.5) twice, tStore.ListDirs() => (%v, %v), want (%v, <nil>)`,
+			dirs, err, wantedDirsAfterDecayTwice)
+	}
+
+	for _, factor := range []float64{-1, 2} {
+		err := tStore.DecayScores(factor)
+		if err == nil {
+			t.Errorf("tStore.DecayScores(%v) => <nil>, want error", factor)
+		}
+	}
 }
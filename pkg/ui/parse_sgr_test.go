@@ -15,6 +15,10 @@ func TestParseSGREscapedText(t *testing.T) {
 			Concat(T("bold", Bold), T("bold red", Bold, FgRed))),
 		tt.Args("\033[1mbold\033[;31mred").Rets(
 			Concat(T("bold", Bold), T("red", FgRed))),
+		// An empty SGR sequence resets the style.
+		tt.Args("\033[1;31mbold red\033[mplain").Rets(
+			Concat(T("bold red", Bold, FgRed), T("plain"))),
+		tt.Args("\033[32mgreen\033[0m").Rets(T("green", FgGreen)),
 		// Non-SGR CSI sequences are removed.
 		tt.Args("\033[Atext").Rets(T("text")),
 		// Control characters not part of CSI escape sequences are left
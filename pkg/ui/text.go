@@ -122,6 +122,19 @@ func (t Text) Clone() Text {
 	return newt
 }
 
+// NoColor returns a copy of the text with the foreground and background colors
+// removed. Other styles, such as bold and inverse, are kept, so that the
+// structure of the text stays visible on terminals without color support.
+func (t Text) NoColor() Text {
+	newt := make(Text, len(t))
+	for i, seg := range t {
+		newseg := seg.Clone()
+		newseg.Foreground, newseg.Background = nil, nil
+		newt[i] = newseg
+	}
+	return newt
+}
+
 // CountRune counts the number of times a rune occurs in a Text.
 func (t Text) CountRune(r rune) int {
 	n := 0
@@ -197,6 +210,15 @@ func (t Text) String() string {
 	return t.VTString()
 }
 
+// PlainString returns the content of the text, without any styling.
+func (t Text) PlainString() string {
+	var buf bytes.Buffer
+	for _, seg := range t {
+		buf.WriteString(seg.Text)
+	}
+	return buf.String()
+}
+
 // VTString renders the styled text using VT-style escape sequences.
 func (t Text) VTString() string {
 	var buf bytes.Buffer
@@ -135,6 +135,43 @@ func TestTrimWcwidth(t *testing.T) {
 	})
 }
 
+func TestNoColor(t *testing.T) {
+	tt.Test(t, tt.Fn("Text.NoColor", Text.NoColor), tt.Table{
+		Args(Text{}).Rets(Text{}),
+		Args(T("foo", FgRed, BgBlue)).Rets(T("foo")),
+		// Styles other than colors are kept.
+		Args(Concat(T("foo", Bold, FgRed), T("bar", Inverse, BgGreen))).Rets(
+			Concat(T("foo", Bold), T("bar", Inverse))),
+	})
+
+	// The original text is not modified.
+	text := T("foo", FgRed)
+	text.NoColor()
+	if text[0].Foreground != Red {
+		t.Errorf("NoColor modified the original text")
+	}
+}
+
+func TestPlainString(t *testing.T) {
+	tt.Test(t, tt.Fn("Text.PlainString", Text.PlainString), tt.Table{
+		Args(Text{}).Rets(""),
+		Args(Concat(T("foo", Bold, FgRed), T(" "), T("bar", Inverse))).Rets("foo bar"),
+	})
+
+	// The plain string is the same whether colors are removed or not, and the
+	// VT string only differs in the escape sequences.
+	text := Concat(T("foo", Bold, FgRed), T("bar", BgBlue))
+	if text.NoColor().PlainString() != text.PlainString() {
+		t.Errorf("NoColor changed the content of the text")
+	}
+	if got, want := text.VTString(), "\033[1;31mfoo\033[m\033[44mbar\033[m"; got != want {
+		t.Errorf("VTString -> %q, want %q", got, want)
+	}
+	if got, want := text.NoColor().VTString(), "\033[1mfoo\033[mbar"; got != want {
+		t.Errorf("VTString of NoColor -> %q, want %q", got, want)
+	}
+}
+
 type textVTStringTest struct {
 	text         Text
 	wantVTString string